@@ -2,83 +2,443 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
+	"github.com/cownetwork/indigo/internal/auth"
+	"github.com/cownetwork/indigo/internal/backoff"
+	"github.com/cownetwork/indigo/internal/cache"
+	"github.com/cownetwork/indigo/internal/certs"
+	"github.com/cownetwork/indigo/internal/config"
+	"github.com/cownetwork/indigo/internal/dao"
 	"github.com/cownetwork/indigo/internal/eventhandler"
+	"github.com/cownetwork/indigo/internal/health"
+	"github.com/cownetwork/indigo/internal/logging"
+	"github.com/cownetwork/indigo/internal/metrics"
 	"github.com/cownetwork/indigo/internal/psql"
+	"github.com/cownetwork/indigo/internal/ratelimit"
+	"github.com/cownetwork/indigo/internal/reqmeta"
 	"github.com/cownetwork/indigo/internal/rpc"
+	"github.com/cownetwork/indigo/internal/tracing"
 	"github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/upper/db/v4/adapter/postgresql"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"log"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"net"
+	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
-	log.Println("Hello World!")
+	conf, printConfig, err := config.Load(os.Args[0], os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		logging.L().Fatal("failed to load configuration", zap.Error(err))
+	}
+	if printConfig {
+		if err := conf.Print(os.Stdout); err != nil {
+			logging.L().Fatal("failed to print configuration", zap.Error(err))
+		}
+		return
+	}
+
+	if err := logging.Setup(conf.Log.Format, conf.Log.Level); err != nil {
+		logging.L().Fatal("failed to set up logging", zap.Error(err))
+	}
+	defer logging.Sync()
+	logger := logging.L()
+
+	logger.Info("Starting indigo ...",
+		zap.String("address", net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port))),
+		zap.Strings("sinks", conf.Events.Sinks),
+	)
+
+	// ctx is done once a termination signal arrives
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:     conf.Tracing.Exporter,
+		OtlpEndpoint: conf.Tracing.OtlpEndpoint,
+		OtlpInsecure: conf.Tracing.OtlpInsecure,
+		SampleRatio:  conf.Tracing.SampleRatio,
+	})
+	if err != nil {
+		logger.Fatal("failed to set up tracing", zap.Error(err))
+	}
+	defer shutdownTracing(context.Background())
+
+	// workers are the background tasks, which are waited for on shutdown
+	var workers sync.WaitGroup
+	run := func(fn func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			fn()
+		}()
+	}
 
 	connUrl := &postgresql.ConnectionURL{
-		Host:     getEnvOrDefault("INDIGO_SERVICE_POSTGRES_URL", "localhost:5432"),
-		User:     getEnvOrDefault("INDIGO_SERVICE_POSTGRES_USER", "test"),
-		Password: getEnvOrDefault("INDIGO_SERVICE_POSTGRES_PASSWORD", "password"),
-		Database: getEnvOrDefault("INDIGO_SERVICE_POSTGRES_DB", "test_database"),
+		Host:     conf.Postgres.Host,
+		User:     conf.Postgres.User,
+		Password: conf.Postgres.Password,
+		Database: conf.Postgres.Database,
 		Options: map[string]string{
-			"search_path": getEnvOrDefault("INDIGO_SERVICE_POSTGRES_SCHEMA", "public"),
+			"search_path": conf.Postgres.Schema,
 		},
 	}
 
-	log.Printf("Connecting to PostgresSQL at %s ...", connUrl.Host)
+	pool := psql.PoolConfig{
+		MaxOpenConns:     conf.Postgres.MaxOpenConns,
+		MaxIdleConns:     conf.Postgres.MaxIdleConns,
+		ConnMaxLifetime:  conf.Postgres.ConnMaxLifetime,
+		StatementTimeout: conf.Postgres.StatementTimeout,
+	}
+
+	connectBackoff := backoff.DefaultConfig()
+	connectBackoff.MaxAttempts = conf.ConnectMaxAttempts
+
+	logger.Info("Connecting to PostgresSQL ...", zap.String("host", connUrl.Host))
 
-	sess, err := postgresql.Open(connUrl)
+	sess, err := psql.Open(ctx, connUrl, pool, connectBackoff)
 	if err != nil {
-		log.Fatalf("failed to connect to postgres: %v", err)
+		logger.Fatal("failed to connect to postgres", zap.Error(err))
 	}
 	defer sess.Close()
 
-	log.Println("Connected to PostgresSQL.")
+	run(func() {
+		psql.KeepAlive(ctx, sess, conf.Postgres.PingInterval, backoff.DefaultConfig())
+	})
 
-	log.Printf("Initialize CloudEvents ...")
+	logger.Info("Connected to PostgresSQL.")
 
-	sender, err := eventhandler.Initialize(
-		getBrokersFromEnv(),
-		getEnvOrDefault("INDIGO_SERVICE_KAFKA_TOPIC", "cow.global.indigo"),
-		getEnvOrDefault("INDIGO_SERVICE_CLOUDEVENTS_SOURCE", "cow.global.indigo-service"),
-	)
+	logger.Info("Initialize CloudEvents ...")
+
+	sinkConfig := eventhandler.SinkConfig{
+		KafkaBrokers:    conf.Kafka.Brokers,
+		KafkaTopic:      conf.Kafka.Topic,
+		KafkaStructured: conf.Kafka.Structured,
+		NatsUrl:         conf.Nats.Url,
+		NatsSubject:     conf.Nats.Subject,
+		HttpTarget:      conf.Events.HttpTarget,
+		FilePath:        conf.Events.File,
+	}
+
+	var sink eventhandler.Sink
+	err = backoff.Retry(ctx, connectBackoff, func(attempt int) error {
+		sink, err = eventhandler.OpenSink(conf.Events.Sinks, sinkConfig)
+		if err != nil {
+			logger.Warn("Could not open event sinks", zap.Int("attempt", attempt), zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		logger.Fatal("failed to initialize cloudevents", zap.Error(err))
+	}
+	defer sink.Close(context.Background())
+
+	eventhandler.Initialize(sink, conf.Events.Source)
+	if err := eventhandler.SetEncoding(conf.Events.Encoding); err != nil {
+		logger.Fatal("failed to initialize cloudevents", zap.Error(err))
+	}
+
+	eventhandler.ConfigureRetries(backoff.Config{
+		InitialInterval: conf.Events.RetryInitialInterval,
+		MaxInterval:     conf.Events.RetryMaxInterval,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxAttempts:     conf.Events.RetryAttempts,
+	})
+
+	var deadLetterSink eventhandler.Sink
+	if len(conf.Events.DeadLetterTopic) > 0 {
+		deadLetterSink, err = eventhandler.NewKafkaSink(conf.Kafka.Brokers, conf.Events.DeadLetterTopic, conf.Kafka.Structured)
+	} else if len(conf.Events.DeadLetterFile) > 0 {
+		deadLetterSink, err = eventhandler.NewFileSink(conf.Events.DeadLetterFile)
+	}
 	if err != nil {
-		log.Fatalf("failed to initialize cloudevents: %v", err)
+		logger.Fatal("failed to initialize dead-letter sink", zap.Error(err))
+	}
+	if deadLetterSink != nil {
+		eventhandler.SetDeadLetterSink(deadLetterSink)
+		defer deadLetterSink.Close(context.Background())
 	}
 
-	defer sender.Close(context.Background())
+	if len(conf.Kafka.SnapshotTopic) > 0 {
+		snapshotSink, err := eventhandler.NewKafkaSink(conf.Kafka.Brokers, conf.Kafka.SnapshotTopic, conf.Kafka.Structured)
+		if err != nil {
+			logger.Fatal("failed to initialize snapshot sink", zap.Error(err))
+		}
+		eventhandler.SetSnapshotSink(snapshotSink)
+		defer snapshotSink.Close(context.Background())
+	}
 
-	log.Println("CloudEvents initialized.")
+	logger.Info("CloudEvents initialized.")
 
 	// setup grpc server
-	address := fmt.Sprintf("%s:%s", getEnvOrDefault("INDIGO_SERVICE_HOST", ""), getEnvOrDefault("INDIGO_SERVICE_PORT", "6969"))
+	address := net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port))
 	lis, err := net.Listen("tcp", address)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		logger.Fatal("failed to listen", zap.Error(err))
+	}
+
+	outbox := metrics.NewDataAccessor(&psql.DataAccessor{Session: sess})
+	run(func() {
+		eventhandler.RunRelay(ctx, outbox, conf.Outbox.Interval, conf.Outbox.BatchSize, conf.Outbox.Lease)
+	})
+
+	if conf.Outbox.Retention > 0 {
+		run(func() {
+			eventhandler.RunCleanup(ctx, outbox, time.Hour, conf.Outbox.Retention)
+		})
+	}
+
+	run(func() {
+		eventhandler.RunWebhooks(ctx, outbox, conf.Webhook.Interval, conf.Webhook.Timeout)
+	})
+
+	if conf.Snapshot.Interval > 0 && len(conf.Kafka.SnapshotTopic) > 0 {
+		run(func() {
+			eventhandler.RunSnapshots(ctx, outbox, conf.Snapshot.Interval, conf.Snapshot.IncludeUsers)
+		})
+	}
+
+	var da dao.DataAccessor = metrics.NewDataAccessor(&psql.DataAccessor{Session: sess})
+	if conf.Cache.Size > 0 {
+		da = cache.New(da, conf.Cache.Size, conf.Cache.Ttl)
+	}
+
+	if conf.Metrics.EntityInterval > 0 {
+		run(func() {
+			metrics.RunEntityGauges(ctx, outbox, conf.Metrics.EntityInterval)
+		})
+	}
+
+	if len(conf.Accounts.Topic) > 0 {
+		accountConfig := eventhandler.AccountConsumerConfig{
+			Brokers:          conf.Kafka.Brokers,
+			Topic:            conf.Accounts.Topic,
+			ConsumerGroup:    conf.Accounts.Group,
+			DeletedEventType: conf.Accounts.DeletedEventType,
+			MergedEventType:  conf.Accounts.MergedEventType,
+		}
+		run(func() {
+			// the consumer is restarted until indigo shuts down,
+			// so that Kafka does not have to be up on startup
+			_ = backoff.Retry(ctx, backoff.DefaultConfig(), func(attempt int) error {
+				err := eventhandler.RunAccountConsumer(ctx, accountConfig, rpc.AccountHandler{Dao: da})
+				if err != nil && ctx.Err() == nil {
+					logger.Warn("Could not consume account events", zap.Int("attempt", attempt), zap.Error(err))
+				}
+				return err
+			})
+		})
+	}
+
+	healthServer := grpchealth.NewServer()
+	monitor := health.NewMonitor(healthServer,
+		indigo.IndigoService_ServiceDesc.ServiceName,
+		rpc.AdminService_ServiceDesc.ServiceName,
+		rpc.WatchService_ServiceDesc.ServiceName,
+	)
+	monitor.Add("postgres", func(ctx context.Context) error {
+		return sess.WithContext(ctx).Ping()
+	})
+	monitor.Add("events", func(ctx context.Context) error {
+		return eventhandler.Check(ctx, sink)
+	})
+	run(func() {
+		monitor.Run(ctx, conf.Health.Interval, conf.Health.Timeout)
+	})
+
+	var httpServer *http.Server
+	if conf.Health.Port > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/", monitor.Handler())
+		mux.Handle("/metrics", promhttp.Handler())
+		httpServer = &http.Server{
+			Addr:    net.JoinHostPort(conf.Host, strconv.Itoa(conf.Health.Port)),
+			Handler: mux,
+		}
+		go func() {
+			if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Fatal("failed to serve health endpoints", zap.Error(err))
+			}
+		}()
+	}
+
+	// the log level can be changed without authentication,
+	// so it is served separately, by default only locally
+	var adminServer *http.Server
+	if len(conf.Log.AdminAddress) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/loglevel", logging.LevelHandler())
+		adminServer = &http.Server{
+			Addr:    conf.Log.AdminAddress,
+			Handler: mux,
+		}
+		go func() {
+			if err := adminServer.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Fatal("failed to serve admin endpoints", zap.Error(err))
+			}
+		}()
+	}
+
+	authInterceptor := &auth.Interceptor{Required: conf.Auth.Required}
+	if len(conf.Auth.APIKeys) > 0 {
+		a, err := auth.NewAPIKeyAuthenticator(conf.Auth.APIKeys)
+		if err != nil {
+			logger.Fatal("failed to load API keys", zap.Error(err))
+		}
+		authInterceptor.Authenticators = append(authInterceptor.Authenticators, a)
+	}
+	if len(conf.Auth.JWKSFile) > 0 {
+		a, err := auth.NewJWTAuthenticator(conf.Auth.JWKSFile, conf.Auth.JWTIssuer, conf.Auth.JWTAudience)
+		if err != nil {
+			logger.Fatal("failed to load JWKS", zap.Error(err))
+		}
+		authInterceptor.Authenticators = append(authInterceptor.Authenticators, a)
+	}
+	if conf.TLS.ClientAuth != certs.ClientAuthNone {
+		identities, err := auth.ParseCertificateIdentities(conf.TLS.ClientIdentities)
+		if err != nil {
+			logger.Fatal("failed to parse client identities", zap.Error(err))
+		}
+		authInterceptor.Authenticators = append(authInterceptor.Authenticators, &auth.CertificateAuthenticator{
+			Identities:           identities,
+			IdentifyByCommonName: conf.TLS.IdentifyByCommonName,
+		})
+	}
+	if len(authInterceptor.Authenticators) == 0 {
+		logger.Warn("No credentials are configured, every caller is trusted with the actor it claims.")
 	}
 
-	s := grpc.NewServer()
+	if len(conf.Authz.Superuser) > 0 {
+		if err := rpc.BootstrapSuperuser(ctx, da, conf.Authz.Superuser); err != nil {
+			logger.Fatal("failed to bootstrap superuser", zap.Error(err))
+		}
+	}
+
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		otelgrpc.UnaryServerInterceptor(),
+		metrics.UnaryServerInterceptor(),
+		reqmeta.UnaryServerInterceptor(),
+		authInterceptor.UnaryServerInterceptor(),
+		logging.UnaryServerInterceptor(),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		otelgrpc.StreamServerInterceptor(),
+		metrics.StreamServerInterceptor(),
+		reqmeta.StreamServerInterceptor(),
+		authInterceptor.StreamServerInterceptor(),
+		logging.StreamServerInterceptor(),
+	}
+	if conf.RateLimit.ReadRate > 0 || conf.RateLimit.WriteRate > 0 || conf.RateLimit.MaxConcurrent > 0 {
+		limiter := ratelimit.New(ratelimit.Config{
+			ReadRate:      conf.RateLimit.ReadRate,
+			ReadBurst:     conf.RateLimit.ReadBurst,
+			WriteRate:     conf.RateLimit.WriteRate,
+			WriteBurst:    conf.RateLimit.WriteBurst,
+			MaxConcurrent: conf.RateLimit.MaxConcurrent,
+		})
+		run(func() {
+			limiter.Run(ctx, time.Minute, 10*time.Minute)
+		})
+		unaryInterceptors = append(unaryInterceptors, limiter.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, limiter.StreamServerInterceptor())
+	}
+	if conf.Authz.Enabled {
+		authorizer := &rpc.Authorizer{Dao: da}
+		unaryInterceptors = append(unaryInterceptors, authorizer.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, authorizer.StreamServerInterceptor())
+	}
+
+	serverOptions := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+	if len(conf.TLS.CertFile) > 0 {
+		reloader, err := certs.NewReloader(certs.Config{
+			CertFile:     conf.TLS.CertFile,
+			KeyFile:      conf.TLS.KeyFile,
+			ClientCAFile: conf.TLS.ClientCAFile,
+			ClientAuth:   conf.TLS.ClientAuth,
+		})
+		if err != nil {
+			logger.Fatal("failed to load TLS files", zap.Error(err))
+		}
+		run(func() {
+			reloader.Run(ctx, conf.TLS.ReloadInterval)
+		})
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(reloader.TLSConfig())))
+	}
+
+	s := grpc.NewServer(serverOptions...)
 	s.RegisterService(&indigo.IndigoService_ServiceDesc, &rpc.IndigoServiceServer{
-		Dao: &psql.DataAccessor{Session: sess},
+		Dao: da,
 	})
+	s.RegisterService(&rpc.AdminService_ServiceDesc, &rpc.AdminServiceServer{
+		Dao: da,
+	})
+	s.RegisterService(&rpc.WatchService_ServiceDesc, &rpc.WatchServiceServer{
+		Dao:          outbox,
+		PollInterval: conf.Watch.PollInterval,
+		Done:         ctx.Done(),
+	})
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve(lis)
+	}()
 
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	select {
+	case err := <-serveErr:
+		logger.Fatal("failed to serve", zap.Error(err))
+	case <-ctx.Done():
 	}
-}
+	// a second signal terminates immediately
+	stop()
 
-func getBrokersFromEnv() []string {
-	list := getEnvOrDefault("INDIGO_SERVICE_KAFKA_BROKERS", "127.0.0.1:9092")
-	return strings.Split(list, ",")
-}
+	logger.Info("Shutting down ...")
+	monitor.Shutdown()
 
-func getEnvOrDefault(env string, def string) string {
-	value := os.Getenv(env)
-	if len(value) == 0 {
-		return def
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(conf.ShutdownTimeout):
+		logger.Warn("Cancelling requests which are still running.")
+		s.Stop()
 	}
-	return value
+	workers.Wait()
+	if httpServer != nil {
+		_ = httpServer.Close()
+	}
+	if adminServer != nil {
+		_ = adminServer.Close()
+	}
+
+	// publish the events queued by the last requests, the deferred
+	// calls then close the sinks and finally the postgres session
+	flushCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+	if err := eventhandler.FlushOutbox(flushCtx, outbox, conf.Outbox.BatchSize, conf.Outbox.Lease); err != nil {
+		logger.Error("Could not publish pending events", zap.Error(err))
+	}
+
+	logger.Info("Shut down.")
 }
@@ -0,0 +1,14 @@
+-- migrate:up
+create table event_outbox
+(
+    id         bigserial primary key,
+    type       varchar(128) not null,
+    payload    bytea        not null,
+    created_at timestamptz  not null default now(),
+    sent_at    timestamptz
+);
+
+create index event_outbox_pending_idx on event_outbox (id) where sent_at is null;
+
+-- migrate:down
+drop table event_outbox;
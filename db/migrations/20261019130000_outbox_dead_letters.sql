@@ -0,0 +1,16 @@
+-- migrate:up
+alter table event_outbox
+    add column attempts   integer not null default 0,
+    add column last_error text    not null default '',
+    add column dead_at    timestamptz;
+
+drop index event_outbox_pending_idx;
+create index event_outbox_pending_idx on event_outbox (id) where sent_at is null and dead_at is null;
+
+-- migrate:down
+drop index event_outbox_pending_idx;
+alter table event_outbox
+    drop column attempts,
+    drop column last_error,
+    drop column dead_at;
+create index event_outbox_pending_idx on event_outbox (id) where sent_at is null;
@@ -0,0 +1,9 @@
+-- migrate:up
+create table event_sequences
+(
+    entity   varchar(256) primary key,
+    sequence bigint not null
+);
+
+-- migrate:down
+drop table event_sequences;
@@ -0,0 +1,15 @@
+-- migrate:up
+create sequence event_outbox_position_seq;
+
+alter table event_outbox
+    add column subject  varchar(256) not null default '',
+    add column position bigint;
+
+create index event_outbox_position_idx on event_outbox (position) where position is not null;
+
+-- migrate:down
+drop index event_outbox_position_idx;
+alter table event_outbox
+    drop column subject,
+    drop column position;
+drop sequence event_outbox_position_seq;
@@ -0,0 +1,17 @@
+-- migrate:up
+create table webhooks
+(
+    id              uuid primary key,
+    url             varchar(2048) not null,
+    event_types     text[]        not null default '{}',
+    secret          varchar(256)  not null,
+    position        bigint        not null default 0,
+    created_at      timestamptz   not null default now(),
+    last_attempt_at timestamptz,
+    last_success_at timestamptz,
+    last_error      text          not null default '',
+    failures        integer       not null default 0
+);
+
+-- migrate:down
+drop table webhooks;
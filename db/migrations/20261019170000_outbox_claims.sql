@@ -0,0 +1,7 @@
+-- migrate:up
+alter table event_outbox
+    add column claimed_until timestamptz;
+
+-- migrate:down
+alter table event_outbox
+    drop column claimed_until;
@@ -0,0 +1,12 @@
+-- migrate:up
+create table event_outbox_horizon
+(
+    id       boolean primary key default true check (id),
+    position bigint  not null
+);
+
+insert into event_outbox_horizon (position)
+select coalesce(max(position), 0) from event_outbox;
+
+-- migrate:down
+drop table event_outbox_horizon;
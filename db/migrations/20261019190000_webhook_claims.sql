@@ -0,0 +1,7 @@
+-- migrate:up
+alter table webhooks
+    add column claimed_until timestamptz;
+
+-- migrate:down
+alter table webhooks
+    drop column claimed_until;
@@ -5,12 +5,24 @@ go 1.16
 require (
 	github.com/Shopify/sarama v1.28.0
 	github.com/cloudevents/sdk-go/protocol/kafka_sarama/v2 v2.4.1
+	github.com/cloudevents/sdk-go/protocol/nats/v2 v2.4.1
 	github.com/cloudevents/sdk-go/v2 v2.4.1
 	github.com/cownetwork/mooapis-go v0.17.2
 	github.com/google/uuid v1.1.2
 	github.com/lib/pq v1.10.0 // indirect
+	github.com/prometheus/client_golang v1.10.0
 	github.com/thoas/go-funk v0.8.0
 	github.com/upper/db/v4 v4.1.0
-	google.golang.org/grpc v1.36.1
-	google.golang.org/protobuf v1.26.0
+	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.25.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	go.uber.org/zap v1.13.0
+	golang.org/x/time v0.0.0-20210723032227-1f47c861a9ac
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
+	google.golang.org/grpc v1.41.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// APIKeyAuthenticator identifies callers by the static
+// API key they send in the x-api-key metadata.
+type APIKeyAuthenticator struct {
+	// identities by the hash of the key, so that looking
+	// up a key does not leak how much of it is right
+	identities map[[sha256.Size]byte]string
+}
+
+// NewAPIKeyAuthenticator returns an APIKeyAuthenticator
+// for the given mappings of the form <identity>:<key>.
+func NewAPIKeyAuthenticator(mappings []string) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{identities: map[[sha256.Size]byte]string{}}
+	for _, m := range mappings {
+		i := strings.IndexByte(m, ':')
+		if i <= 0 || i == len(m)-1 {
+			return nil, errors.New("invalid API key, expected <identity>:<key>")
+		}
+		hash := sha256.Sum256([]byte(m[i+1:]))
+		if other, ok := a.identities[hash]; ok {
+			return nil, fmt.Errorf("API key of %s is also used by %s", m[:i], other)
+		}
+		a.identities[hash] = m[:i]
+	}
+	return a, nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context) (*Identity, error) {
+	key := header(ctx, APIKeyHeader)
+	if len(key) == 0 {
+		return nil, ErrNoCredentials
+	}
+	name, ok := a.identities[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, errors.New("unknown API key")
+	}
+	return &Identity{Name: name, Method: MethodAPIKey}, nil
+}
@@ -0,0 +1,155 @@
+// Package auth determines the identity of the callers of indigo.
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/cownetwork/indigo/internal/reqmeta"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+const (
+	MethodCertificate = "certificate"
+	MethodAPIKey      = "api_key"
+	MethodJWT         = "jwt"
+
+	APIKeyHeader        = "x-api-key"
+	AuthorizationHeader = "authorization"
+)
+
+// ErrNoCredentials is returned by an Authenticator if
+// the request carries none of the credentials it checks.
+var ErrNoCredentials = errors.New("no credentials")
+
+// exemptServices can be called without credentials.
+var exemptServices = []string{"/grpc.health.v1.Health/"}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Name identifies the caller, e.g. a game server.
+	Name string
+	// Method is how the caller was authenticated.
+	Method string
+}
+
+type identityKey struct{}
+
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the Identity of the caller of the request
+// ctx belongs to, if the caller has been authenticated.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+// Authenticator determines the identity of the caller of a request.
+// It returns ErrNoCredentials if the request carries none of the
+// credentials it checks, and another error if they are invalid.
+type Authenticator interface {
+	Authenticate(ctx context.Context) (*Identity, error)
+}
+
+// Interceptor authenticates every request with the first of its
+// Authenticators the request carries credentials for, attaches the
+// Identity to the context of the request and makes it the actor of
+// the request. As the actor sent by the caller can be forged, it is
+// only kept as long as no Authenticators are configured. It has to
+// run after the interceptor of reqmeta.
+type Interceptor struct {
+	Authenticators []Authenticator
+	// Required rejects requests without credentials.
+	// Invalid credentials are always rejected.
+	Required bool
+}
+
+// Exempt returns whether the method can be called without credentials.
+func Exempt(method string) bool {
+	for _, service := range exemptServices {
+		if strings.HasPrefix(method, service) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Interceptor) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if Exempt(method) {
+		return ctx, nil
+	}
+
+	for _, a := range i.Authenticators {
+		id, err := a.Authenticate(ctx)
+		if err == ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "could not authenticate: %v", err)
+		}
+
+		return withActor(NewContext(ctx, id), id.Name), nil
+	}
+
+	if i.Required {
+		return nil, status.Error(codes.Unauthenticated, "missing credentials")
+	}
+	if len(i.Authenticators) > 0 {
+		return withActor(ctx, ""), nil
+	}
+	return ctx, nil
+}
+
+// withActor replaces the actor of the request ctx belongs to.
+func withActor(ctx context.Context, actor string) context.Context {
+	meta := *reqmeta.FromContext(ctx)
+	meta.Actor = actor
+	return reqmeta.NewContext(ctx, &meta)
+}
+
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (i *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// header returns the first value of the gRPC metadata key of ctx.
+func header(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
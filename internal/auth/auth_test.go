@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/reqmeta"
+	"testing"
+)
+
+type staticAuthenticator struct {
+	id *Identity
+}
+
+func (a staticAuthenticator) Authenticate(ctx context.Context) (*Identity, error) {
+	if a.id == nil {
+		return nil, ErrNoCredentials
+	}
+	return a.id, nil
+}
+
+func TestInterceptorActor(t *testing.T) {
+	tests := []struct {
+		name  string
+		i     *Interceptor
+		actor string
+	}{
+		{
+			name:  "no authenticators",
+			i:     &Interceptor{},
+			actor: "forged",
+		},
+		{
+			name:  "authenticated",
+			i:     &Interceptor{Authenticators: []Authenticator{staticAuthenticator{id: &Identity{Name: "lobby"}}}},
+			actor: "lobby",
+		},
+		{
+			name:  "unauthenticated",
+			i:     &Interceptor{Authenticators: []Authenticator{staticAuthenticator{}}},
+			actor: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := reqmeta.NewContext(context.Background(), &reqmeta.Meta{Actor: "forged"})
+			ctx, err := test.i.authenticate(ctx, "/cow.indigo.v1.IndigoService/GetRole")
+			if err != nil {
+				t.Fatalf("authenticate failed: %v", err)
+			}
+			if actor := reqmeta.FromContext(ctx).Actor; actor != test.actor {
+				t.Errorf("actor is %q, want %q", actor, test.actor)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"strings"
+)
+
+// CertificateAuthenticator identifies callers by the verified
+// client certificate of their TLS connection.
+type CertificateAuthenticator struct {
+	// Identities maps the common names of certificate subjects to identities.
+	Identities map[string]string
+	// IdentifyByCommonName identifies certificates with other common names
+	// by the common name. Otherwise they are rejected, as anyone the CA
+	// issued a certificate to could choose the identity it claims.
+	IdentifyByCommonName bool
+}
+
+// ParseCertificateIdentities parses the mappings of the
+// form <common name>=<identity> of CertificateAuthenticator.
+func ParseCertificateIdentities(mappings []string) (map[string]string, error) {
+	identities := map[string]string{}
+	for _, m := range mappings {
+		i := strings.LastIndexByte(m, '=')
+		if i <= 0 || i == len(m)-1 {
+			return nil, fmt.Errorf("invalid certificate identity %q, expected <common name>=<identity>", m)
+		}
+		identities[m[:i]] = m[i+1:]
+	}
+	return identities, nil
+}
+
+// Authenticate returns the identity of the verified client
+// certificate of the connection of ctx.
+func (a *CertificateAuthenticator) Authenticate(ctx context.Context) (*Identity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cn := info.State.VerifiedChains[0][0].Subject.CommonName
+	if len(cn) == 0 {
+		return nil, errors.New("client certificate has no common name")
+	}
+	name, ok := a.Identities[cn]
+	if !ok {
+		if !a.IdentifyByCommonName {
+			return nil, fmt.Errorf("client certificate %q is not mapped to an identity", cn)
+		}
+		name = cn
+	}
+	return &Identity{Name: name, Method: MethodCertificate}, nil
+}
@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// leeway is the clock skew tolerated when checking exp and nbf.
+const leeway = time.Minute
+
+// JWTAuthenticator identifies callers by the subject of the JWT they send
+// as bearer token in the authorization metadata. The token has to be
+// signed by a key of the JWKS it was created with and must not be expired.
+type JWTAuthenticator struct {
+	keys []jwk
+	// Issuer and Audience are checked, unless they are empty.
+	Issuer   string
+	Audience string
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	key crypto.PublicKey
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  audience    `json:"aud"`
+	ExpiresAt json.Number `json:"exp"`
+	NotBefore json.Number `json:"nbf"`
+}
+
+// audience is a single audience or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// NewJWTAuthenticator reads the signing keys from the JWKS file.
+// RSA, ECDSA and Ed25519 keys are supported.
+func NewJWTAuthenticator(jwksFile string, issuer string, aud string) (*JWTAuthenticator, error) {
+	b, err := ioutil.ReadFile(jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read JWKS file: %v", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("could not parse JWKS file: %v", err)
+	}
+
+	a := &JWTAuthenticator{Issuer: issuer, Audience: aud}
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+		k.key, err = k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("could not parse key %q of JWKS file: %v", k.Kid, err)
+		}
+		a.keys = append(a.keys, k)
+	}
+	if len(a.keys) == 0 {
+		return nil, errors.New("JWKS file contains no signing keys")
+	}
+	return a, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context) (*Identity, error) {
+	auth := header(ctx, AuthorizationHeader)
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.verify(auth[7:], time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Name: claims.Subject, Method: MethodJWT}, nil
+}
+
+func (a *JWTAuthenticator) verify(token string, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var h jwtHeader
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %v", err)
+	}
+	key, err := a.key(h)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(h.Alg, key.key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var c jwtClaims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	if len(c.Subject) == 0 {
+		return nil, errors.New("token has no subject")
+	}
+	exp, err := c.ExpiresAt.Float64()
+	if err != nil {
+		return nil, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return nil, errors.New("token is expired")
+	}
+	if nbf, err := c.NotBefore.Float64(); err == nil && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if len(a.Issuer) > 0 && c.Issuer != a.Issuer {
+		return nil, fmt.Errorf("token has wrong issuer %q", c.Issuer)
+	}
+	if len(a.Audience) > 0 && !c.Audience.contains(a.Audience) {
+		return nil, errors.New("token is not meant for indigo")
+	}
+	return &c, nil
+}
+
+// key returns the key the token is signed with.
+func (a *JWTAuthenticator) key(h jwtHeader) (*jwk, error) {
+	for i, k := range a.keys {
+		if len(h.Kid) > 0 && k.Kid != h.Kid {
+			continue
+		}
+		if len(h.Kid) == 0 && len(a.keys) > 1 {
+			return nil, errors.New("token has no key id")
+		}
+		if len(k.Alg) > 0 && k.Alg != h.Alg {
+			return nil, fmt.Errorf("token is signed with %s, but key %q is for %s", h.Alg, k.Kid, k.Alg)
+		}
+		return &a.keys[i], nil
+	}
+	return nil, fmt.Errorf("unknown key %q", h.Kid)
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, input []byte, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	}
+
+	invalid := errors.New("invalid token signature")
+	switch {
+	case alg == "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(k, input, sig) {
+			return invalid
+		}
+		return nil
+	case hash == 0:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(input)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(k, hash, digest, sig) != nil {
+			return invalid
+		}
+	case "PS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPSS(k, hash, digest, sig, nil) != nil {
+			return invalid
+		}
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return invalid
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return invalid
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+// newTestAuthenticator writes a JWKS with an RSA key for RS256, an RSA
+// key for any algorithm and an EC key for ES256 and returns an
+// authenticator for it.
+func newTestAuthenticator(t *testing.T) *JWTAuthenticator {
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kid": "rsa",
+				"kty": "RSA",
+				"alg": "RS256",
+				"n":   encodeBigInt(testRSAKey.N),
+				"e":   encodeBigInt(big.NewInt(int64(testRSAKey.E))),
+			},
+			{
+				"kid": "rsa-any",
+				"kty": "RSA",
+				"n":   encodeBigInt(testRSAKey.N),
+				"e":   encodeBigInt(big.NewInt(int64(testRSAKey.E))),
+			},
+			{
+				"kid": "ec",
+				"kty": "EC",
+				"alg": "ES256",
+				"crv": "P-256",
+				"x":   encodeBigInt(testECKey.X),
+				"y":   encodeBigInt(testECKey.Y),
+			},
+		},
+	}
+	b, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(file, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewJWTAuthenticator(file, "issuer", "indigo")
+	if err != nil {
+		t.Fatalf("could not create authenticator: %v", err)
+	}
+	return a
+}
+
+// sign creates a token with the header and claims, signed
+// with the RSA key for RS256 and the EC key for ES256.
+func sign(t *testing.T, header map[string]interface{}, claims map[string]interface{}) string {
+	input := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch header["alg"] {
+	case "RS256":
+		s, err := rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = s
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, testECKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// withSignature replaces the signature of token by the result of fn.
+func withSignature(token string, fn func(sig []byte) []byte) string {
+	i := strings.LastIndexByte(token, '.')
+	sig, _ := base64.RawURLEncoding.DecodeString(token[i+1:])
+	return token[:i+1] + base64.RawURLEncoding.EncodeToString(fn(sig))
+}
+
+// hs256 signs the token with HMAC, using the public RSA
+// key as secret, as done to confuse the algorithms.
+func hs256(t *testing.T, kid string, claims map[string]interface{}) string {
+	input := encodeSegment(t, map[string]interface{}{"alg": "HS256", "kid": kid}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, x509.MarshalPKCS1PublicKey(&testRSAKey.PublicKey))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerify(t *testing.T) {
+	a := newTestAuthenticator(t)
+	now := time.Now()
+	claims := func(modify func(c map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "lobby",
+			"iss": "issuer",
+			"aud": "indigo",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+	rs256 := map[string]interface{}{"alg": "RS256", "kid": "rsa"}
+	es256 := map[string]interface{}{"alg": "ES256", "kid": "ec"}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{
+			name:  "valid RS256",
+			token: sign(t, rs256, claims(nil)),
+		},
+		{
+			name:  "valid ES256",
+			token: sign(t, es256, claims(nil)),
+		},
+		{
+			name: "audience list",
+			token: sign(t, rs256, claims(func(c map[string]interface{}) {
+				c["aud"] = []string{"other", "indigo"}
+			})),
+		},
+		{
+			name: "expired",
+			token: sign(t, rs256, claims(func(c map[string]interface{}) {
+				c["exp"] = now.Add(-2 * leeway).Unix()
+			})),
+			err: "token is expired",
+		},
+		{
+			name: "expired within leeway",
+			token: sign(t, rs256, claims(func(c map[string]interface{}) {
+				c["exp"] = now.Add(-leeway / 2).Unix()
+			})),
+		},
+		{
+			name: "no expiry",
+			token: sign(t, rs256, claims(func(c map[string]interface{}) {
+				delete(c, "exp")
+			})),
+			err: "token has no expiry",
+		},
+		{
+			name: "not valid yet",
+			token: sign(t, rs256, claims(func(c map[string]interface{}) {
+				c["nbf"] = now.Add(2 * leeway).Unix()
+			})),
+			err: "token is not valid yet",
+		},
+		{
+			name: "wrong issuer",
+			token: sign(t, rs256, claims(func(c map[string]interface{}) {
+				c["iss"] = "other"
+			})),
+			err: "token has wrong issuer",
+		},
+		{
+			name: "wrong audience",
+			token: sign(t, rs256, claims(func(c map[string]interface{}) {
+				c["aud"] = "other"
+			})),
+			err: "token is not meant for indigo",
+		},
+		{
+			name:  "unknown kid",
+			token: sign(t, map[string]interface{}{"alg": "RS256", "kid": "unknown"}, claims(nil)),
+			err:   `unknown key "unknown"`,
+		},
+		{
+			name:  "no kid with several keys",
+			token: sign(t, map[string]interface{}{"alg": "RS256"}, claims(nil)),
+			err:   "token has no key id",
+		},
+		{
+			name:  "alg mismatch",
+			token: sign(t, map[string]interface{}{"alg": "ES256", "kid": "rsa"}, claims(nil)),
+			err:   `token is signed with ES256, but key "rsa" is for RS256`,
+		},
+		{
+			name:  "alg none",
+			token: encodeSegment(t, map[string]interface{}{"alg": "none", "kid": "rsa"}) + "." + encodeSegment(t, claims(nil)) + ".",
+			err:   `token is signed with none, but key "rsa" is for RS256`,
+		},
+		{
+			name:  "alg none without alg of key",
+			token: encodeSegment(t, map[string]interface{}{"alg": "none", "kid": "rsa-any"}) + "." + encodeSegment(t, claims(nil)) + ".",
+			err:   `unsupported algorithm "none"`,
+		},
+		{
+			name:  "valid RS256 without alg of key",
+			token: sign(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-any"}, claims(nil)),
+		},
+		{
+			name:  "HS256 with RSA key",
+			token: hs256(t, "rsa", claims(nil)),
+			err:   `token is signed with HS256, but key "rsa" is for RS256`,
+		},
+		{
+			name:  "HS256 with RSA key without alg",
+			token: hs256(t, "rsa-any", claims(nil)),
+			err:   `unsupported algorithm "HS256"`,
+		},
+		{
+			name:  "ES256 with RSA key without alg",
+			token: sign(t, map[string]interface{}{"alg": "ES256", "kid": "rsa-any"}, claims(nil)),
+			err:   "invalid token signature",
+		},
+		{
+			name: "truncated ECDSA signature",
+			token: withSignature(sign(t, es256, claims(nil)), func(sig []byte) []byte {
+				return sig[:len(sig)-1]
+			}),
+			err: "invalid token signature",
+		},
+		{
+			name: "overlong ECDSA signature",
+			token: withSignature(sign(t, es256, claims(nil)), func(sig []byte) []byte {
+				return append(sig, 0)
+			}),
+			err: "invalid token signature",
+		},
+		{
+			name: "tampered claims",
+			token: func() string {
+				parts := strings.Split(sign(t, rs256, claims(nil)), ".")
+				parts[1] = encodeSegment(t, claims(func(c map[string]interface{}) {
+					c["sub"] = "admin"
+				}))
+				return strings.Join(parts, ".")
+			}(),
+			err: "invalid token signature",
+		},
+		{
+			name: "tampered signature",
+			token: func() string {
+				token := sign(t, es256, claims(nil))
+				last := token[len(token)-2]
+				if last == 'A' {
+					last = 'B'
+				} else {
+					last = 'A'
+				}
+				return token[:len(token)-2] + string(last) + token[len(token)-1:]
+			}(),
+			err: "invalid token signature",
+		},
+		{
+			name:  "malformed",
+			token: "not-a-token",
+			err:   "malformed token",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := a.verify(test.token, now)
+			if len(test.err) == 0 {
+				if err != nil {
+					t.Fatalf("verify failed: %v", err)
+				}
+				if c.Subject != "lobby" {
+					t.Errorf("subject is %q, want lobby", c.Subject)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("verify returned %v, want %q", err, test.err)
+			}
+		})
+	}
+}
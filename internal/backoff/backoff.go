@@ -0,0 +1,69 @@
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Config describes an exponential backoff. The delay before
+// attempt n (starting at 1) is InitialInterval * Multiplier^(n-1),
+// capped at MaxInterval and randomized by +/- Jitter percent.
+type Config struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+	// MaxAttempts is the maximum number of attempts. Zero means
+	// that it will retry until the context is done.
+	MaxAttempts int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// Delay returns the time to wait after the given failed attempt.
+func (c Config) Delay(attempt int) time.Duration {
+	d := float64(c.InitialInterval)
+	for i := 1; i < attempt; i++ {
+		d *= c.Multiplier
+		if c.MaxInterval > 0 && d >= float64(c.MaxInterval) {
+			break
+		}
+	}
+	if c.MaxInterval > 0 && d > float64(c.MaxInterval) {
+		d = float64(c.MaxInterval)
+	}
+	if c.Jitter > 0 {
+		d += d * c.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// Retry calls fn until it returns nil, the maximum amount of attempts
+// is reached or ctx is done. The last error of fn is returned.
+func Retry(ctx context.Context, c Config, fn func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return nil
+		}
+		if c.MaxAttempts > 0 && attempt >= c.MaxAttempts {
+			return err
+		}
+
+		t := time.NewTimer(c.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
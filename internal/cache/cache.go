@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/model"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"time"
+)
+
+const listRolesKey = "list"
+
+// DataAccessor decorates another dao.DataAccessor and caches role
+// definitions and role permissions, which are read on every permission
+// check but rarely change. Writes done through the DataAccessor
+// invalidate the affected entries, writes done by other instances
+// become visible once the ttl expired.
+type DataAccessor struct {
+	dao.DataAccessor
+	roles       *lru
+	permissions *lru
+}
+
+// New wraps da with caches that hold at most size entries each
+// for at most ttl. A ttl of zero lets entries never expire.
+func New(da dao.DataAccessor, size int, ttl time.Duration) *DataAccessor {
+	return &DataAccessor{
+		DataAccessor: da,
+		roles:        newLru(size, ttl),
+		permissions:  newLru(size, ttl),
+	}
+}
+
+// Tx runs fn on the undecorated DataAccessor, so that uncommitted
+// data never ends up in the cache, and invalidates everything
+// once the transaction ended.
+func (d *DataAccessor) Tx(ctx context.Context, fn func(tx dao.DataAccessor) error) error {
+	defer d.permissions.Purge()
+	defer d.roles.Purge()
+	return d.DataAccessor.Tx(ctx, fn)
+}
+
+func (d *DataAccessor) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	if v, ok := d.roles.Get(listRolesKey); ok {
+		return cloneRoles(v.([]*model.Role)), nil
+	}
+
+	gen := d.roles.Generation()
+	roles, err := d.DataAccessor.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.roles.Put(listRolesKey, cloneRoles(roles), gen)
+	return roles, nil
+}
+
+func (d *DataAccessor) InsertRole(ctx context.Context, role *model.Role) error {
+	defer d.roles.Purge()
+	return d.DataAccessor.InsertRole(ctx, role)
+}
+
+func (d *DataAccessor) UpdateRole(ctx context.Context, roleId *pb.RoleIdentifier, role *model.Role) error {
+	defer d.roles.Purge()
+	return d.DataAccessor.UpdateRole(ctx, roleId, role)
+}
+
+func (d *DataAccessor) GetRole(ctx context.Context, roleId *pb.RoleIdentifier) (*model.Role, error) {
+	key := roleKey(roleId)
+	if len(key) == 0 {
+		return d.DataAccessor.GetRole(ctx, roleId)
+	}
+	if v, ok := d.roles.Get(key); ok {
+		return cloneRole(v.(*model.Role)), nil
+	}
+
+	gen := d.roles.Generation()
+	role, err := d.DataAccessor.GetRole(ctx, roleId)
+	if err != nil || role == nil {
+		return role, err
+	}
+	d.roles.Put(key, cloneRole(role), gen)
+	return role, nil
+}
+
+func (d *DataAccessor) DeleteRole(ctx context.Context, roleId string) error {
+	defer d.permissions.Remove(roleId)
+	defer d.roles.Purge()
+	return d.DataAccessor.DeleteRole(ctx, roleId)
+}
+
+func (d *DataAccessor) GetRolePermissions(ctx context.Context, roleId string) ([]*model.RolePermissionBinding, error) {
+	if v, ok := d.permissions.Get(roleId); ok {
+		return cloneBindings(v.([]*model.RolePermissionBinding)), nil
+	}
+
+	gen := d.permissions.Generation()
+	bindings, err := d.DataAccessor.GetRolePermissions(ctx, roleId)
+	if err != nil {
+		return nil, err
+	}
+	d.permissions.Put(roleId, cloneBindings(bindings), gen)
+	return bindings, nil
+}
+
+func (d *DataAccessor) AddRolePermissions(ctx context.Context, roleId string, permissions []string) ([]string, error) {
+	defer d.permissions.Remove(roleId)
+	return d.DataAccessor.AddRolePermissions(ctx, roleId, permissions)
+}
+
+func (d *DataAccessor) RemoveRolePermissions(ctx context.Context, roleId string, permissions []string) ([]string, error) {
+	defer d.permissions.Remove(roleId)
+	return d.DataAccessor.RemoveRolePermissions(ctx, roleId, permissions)
+}
+
+func roleKey(roleId *pb.RoleIdentifier) string {
+	switch u := roleId.Id.(type) {
+	case *pb.RoleIdentifier_Uuid:
+		return "id:" + u.Uuid
+	case *pb.RoleIdentifier_NameId:
+		return "name:" + u.NameId.Type + ":" + u.NameId.Name
+	}
+	return ""
+}
+
+// the handlers modify the roles they get, so
+// the cache must never hand out its own instances.
+
+func cloneRole(r *model.Role) *model.Role {
+	c := *r
+	c.Permissions = append([]string(nil), r.Permissions...)
+	return &c
+}
+
+func cloneRoles(roles []*model.Role) []*model.Role {
+	c := make([]*model.Role, len(roles))
+	for i, r := range roles {
+		c[i] = cloneRole(r)
+	}
+	return c
+}
+
+func cloneBindings(bindings []*model.RolePermissionBinding) []*model.RolePermissionBinding {
+	c := make([]*model.RolePermissionBinding, len(bindings))
+	for i, b := range bindings {
+		binding := *b
+		c[i] = &binding
+	}
+	return c
+}
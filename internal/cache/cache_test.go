@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/model"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"testing"
+	"time"
+)
+
+const testRoleId = "b6f1f5a4-8e2d-4c3b-a1d7-2f9e6c4b8a53"
+
+// countingDao counts the reads of roles and role permissions. The
+// methods which are not needed by the tests panic, as the embedded
+// DataAccessor is nil.
+type countingDao struct {
+	dao.DataAccessor
+
+	roleReads       int
+	permissionReads int
+	// onRead is called during every read, before it returns.
+	onRead func()
+}
+
+func (d *countingDao) Tx(_ context.Context, fn func(tx dao.DataAccessor) error) error {
+	return fn(d)
+}
+
+func (d *countingDao) GetRole(_ context.Context, roleId *pb.RoleIdentifier) (*model.Role, error) {
+	d.roleReads++
+	if d.onRead != nil {
+		d.onRead()
+	}
+	return &model.Role{Id: testRoleId, Name: "default", Type: "test"}, nil
+}
+
+func (d *countingDao) GetRolePermissions(_ context.Context, roleId string) ([]*model.RolePermissionBinding, error) {
+	d.permissionReads++
+	if d.onRead != nil {
+		d.onRead()
+	}
+	return []*model.RolePermissionBinding{{RoleId: roleId, Permission: "cow.chat"}}, nil
+}
+
+func (d *countingDao) AddRolePermissions(_ context.Context, roleId string, permissions []string) ([]string, error) {
+	return permissions, nil
+}
+
+func read(t *testing.T, c *DataAccessor) {
+	t.Helper()
+	if _, err := c.GetRole(context.Background(), model.ToRoleUuidIdentifier(testRoleId)); err != nil {
+		t.Fatalf("could not get role: %v", err)
+	}
+	if _, err := c.GetRolePermissions(context.Background(), testRoleId); err != nil {
+		t.Fatalf("could not get role permissions: %v", err)
+	}
+}
+
+func expectReads(t *testing.T, d *countingDao, roles int, permissions int) {
+	t.Helper()
+	if d.roleReads != roles || d.permissionReads != permissions {
+		t.Errorf("read roles %d and permissions %d times, want %d and %d", d.roleReads, d.permissionReads, roles, permissions)
+	}
+}
+
+func TestPutRacingInvalidationIsDropped(t *testing.T) {
+	d := &countingDao{}
+	c := New(d, 10, 0)
+
+	// another request changes the permissions while they are read,
+	// which only invalidates the permissions of the role
+	d.onRead = func() {
+		_, _ = c.AddRolePermissions(context.Background(), testRoleId, []string{"cow.fly"})
+	}
+	read(t, c)
+	d.onRead = nil
+
+	read(t, c)
+	expectReads(t, d, 1, 2)
+	read(t, c)
+	expectReads(t, d, 1, 2)
+}
+
+func TestExpiredEntriesAreReadAgain(t *testing.T) {
+	d := &countingDao{}
+	c := New(d, 10, 20*time.Millisecond)
+
+	read(t, c)
+	read(t, c)
+	expectReads(t, d, 1, 1)
+
+	time.Sleep(40 * time.Millisecond)
+	read(t, c)
+	expectReads(t, d, 2, 2)
+}
+
+func TestTxPurgesBothCaches(t *testing.T) {
+	d := &countingDao{}
+	c := New(d, 10, 0)
+
+	read(t, c)
+	err := c.Tx(context.Background(), func(tx dao.DataAccessor) error {
+		_, err := tx.AddRolePermissions(context.Background(), testRoleId, []string{"cow.fly"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+
+	read(t, c)
+	expectReads(t, d, 2, 2)
+}
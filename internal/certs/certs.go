@@ -0,0 +1,176 @@
+// Package certs provides the TLS configuration of the gRPC server,
+// whose certificate and client CA bundle are reloaded once their
+// files change.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/cownetwork/indigo/internal/logging"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the PEM bundle of the CAs client certificates are
+	// verified against. It is required unless ClientAuth is ClientAuthNone.
+	ClientCAFile string
+	// ClientAuth is ClientAuthNone, ClientAuthRequest to verify client
+	// certificates if they are sent, or ClientAuthRequire.
+	ClientAuth string
+}
+
+// Reloader serves the certificate and the client CA bundle which
+// were most recently read from their files.
+type Reloader struct {
+	config     Config
+	clientAuth tls.ClientAuthType
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// NewReloader reads the files of c once.
+func NewReloader(c Config) (*Reloader, error) {
+	r := &Reloader{config: c}
+	switch c.ClientAuth {
+	case ClientAuthNone:
+		r.clientAuth = tls.NoClientCert
+	case ClientAuthRequest:
+		r.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		r.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth %q", c.ClientAuth)
+	}
+	if r.clientAuth != tls.NoClientCert && len(c.ClientCAFile) == 0 {
+		return nil, fmt.Errorf("client auth %q requires a client CA file", c.ClientAuth)
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the configuration of the server, which
+// picks up reloaded files with every new connection.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   r.clientAuth,
+				ClientCAs:    r.clientCAs,
+				// grpc sets this only on the outer configuration
+				NextProtos: []string{"h2"},
+			}, nil
+		},
+	}
+}
+
+// Run checks the files every interval until ctx is done and reloads
+// them if they changed. The previous files are kept if reloading fails.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := r.changed()
+		if err != nil {
+			logging.L().Warn("Could not check TLS files", zap.Error(err))
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := r.reload(); err != nil {
+			logging.L().Error("Could not reload TLS files", zap.Error(err))
+			continue
+		}
+		logging.L().Info("Reloaded TLS files.")
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if len(r.config.ClientCAFile) > 0 {
+		files = append(files, r.config.ClientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) changed() (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Reloader) reload() error {
+	modTimes := map[string]time.Time{}
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("could not load certificate: %v", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if len(r.config.ClientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("could not read client CA file: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("client CA file %s contains no certificates", r.config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
@@ -0,0 +1,385 @@
+// Package config contains the configuration of indigo, which is read
+// from a YAML file, INDIGO_SERVICE_* environment variables and flags.
+package config
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of indigo. Every field can be set in the
+// configuration file by its yaml key, by the environment variable
+// INDIGO_SERVICE_<env> and by the flag of the dotted yaml keys.
+type Config struct {
+	Host               string        `yaml:"host" env:"HOST" usage:"Host to bind the service to. Empty binds to all interfaces."`
+	Port               int           `yaml:"port" env:"PORT" usage:"Port to bind the service to."`
+	ConnectMaxAttempts int           `yaml:"connect_max_attempts" env:"CONNECT_MAX_ATTEMPTS" usage:"How often connecting to the postgres and Kafka is tried on startup."`
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"How long running requests are waited for and pending events are published on shutdown."`
+
+	TLS       TLS       `yaml:"tls"`
+	Auth      Auth      `yaml:"auth"`
+	Authz     Authz     `yaml:"authz"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	Log       Log       `yaml:"log"`
+	Health    Health    `yaml:"health"`
+	Metrics   Metrics   `yaml:"metrics"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Postgres  Postgres  `yaml:"postgres"`
+	Cache     Cache     `yaml:"cache"`
+	Events    Events    `yaml:"events"`
+	Kafka     Kafka     `yaml:"kafka"`
+	Nats      Nats      `yaml:"nats"`
+	Outbox    Outbox    `yaml:"outbox"`
+	Snapshot  Snapshot  `yaml:"snapshot"`
+	Watch     Watch     `yaml:"watch"`
+	Webhook   Webhook   `yaml:"webhook"`
+	Accounts  Accounts  `yaml:"accounts"`
+}
+
+type TLS struct {
+	CertFile             string        `yaml:"cert_file" env:"TLS_CERT_FILE" usage:"PEM certificate of the gRPC server. TLS is disabled if empty."`
+	KeyFile              string        `yaml:"key_file" env:"TLS_KEY_FILE" usage:"PEM private key of the certificate."`
+	ClientCAFile         string        `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE" usage:"PEM bundle of the CAs client certificates are verified against."`
+	ClientAuth           string        `yaml:"client_auth" env:"TLS_CLIENT_AUTH" usage:"Whether clients send certificates: none, request to verify them if sent, or require."`
+	ClientIdentities     []string      `yaml:"client_identities" env:"TLS_CLIENT_IDENTITIES" usage:"Identities of clients by the common name of their certificate, as <common name>=<identity>. Other clients are rejected."`
+	IdentifyByCommonName bool          `yaml:"identify_by_common_name" env:"TLS_IDENTIFY_BY_COMMON_NAME" usage:"Identify clients whose common name is not in client_identities by their common name instead of rejecting them."`
+	ReloadInterval       time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL" usage:"Interval in which the certificate and CA files are checked for changes."`
+}
+
+type Auth struct {
+	Required    bool     `yaml:"required" env:"AUTH_REQUIRED" usage:"Reject requests without an API key, JWT or verified client certificate."`
+	APIKeys     []string `yaml:"api_keys" env:"AUTH_API_KEYS" secret:"true" usage:"Static API keys of the callers, as <identity>:<key>."`
+	JWKSFile    string   `yaml:"jwks_file" env:"AUTH_JWKS_FILE" usage:"JWKS file the JWTs of the callers are verified with. JWTs are not accepted if empty."`
+	JWTIssuer   string   `yaml:"jwt_issuer" env:"AUTH_JWT_ISSUER" usage:"Required issuer of the JWTs. Not checked if empty."`
+	JWTAudience string   `yaml:"jwt_audience" env:"AUTH_JWT_AUDIENCE" usage:"Required audience of the JWTs. Not checked if empty."`
+}
+
+type Authz struct {
+	Enabled   bool   `yaml:"enabled" env:"AUTHZ_ENABLED" usage:"Require callers to have the indigo.* permission of a method in indigo itself, with the identity as account id."`
+	Superuser string `yaml:"superuser" env:"AUTHZ_SUPERUSER" usage:"Account id the superuser role, which has every permission, is bound to on startup."`
+}
+
+type RateLimit struct {
+	ReadRate      float64 `yaml:"read_rate" env:"RATE_LIMIT_READ_RATE" usage:"Read requests per second a caller can make on average. 0 disables the limit."`
+	ReadBurst     int     `yaml:"read_burst" env:"RATE_LIMIT_READ_BURST" usage:"Read requests a caller can make at once."`
+	WriteRate     float64 `yaml:"write_rate" env:"RATE_LIMIT_WRITE_RATE" usage:"Write requests per second a caller can make on average. 0 disables the limit."`
+	WriteBurst    int     `yaml:"write_burst" env:"RATE_LIMIT_WRITE_BURST" usage:"Write requests a caller can make at once."`
+	MaxConcurrent int     `yaml:"max_concurrent" env:"RATE_LIMIT_MAX_CONCURRENT" usage:"Requests of a caller which can run at the same time. 0 disables the limit."`
+}
+
+type Log struct {
+	Level        string `yaml:"level" env:"LOG_LEVEL" usage:"Minimum level of logged messages: debug, info, warn or error. Can be changed at runtime on /loglevel."`
+	Format       string `yaml:"format" env:"LOG_FORMAT" usage:"Format of the log: json or text."`
+	AdminAddress string `yaml:"admin_address" env:"LOG_ADMIN_ADDRESS" usage:"Address of the HTTP server serving /loglevel, which anyone reaching it can change the level with. Empty disables it."`
+}
+
+type Health struct {
+	Port     int           `yaml:"port" env:"HEALTH_PORT" usage:"Port of the HTTP server serving /healthz, /readyz and /metrics. 0 disables it."`
+	Interval time.Duration `yaml:"interval" env:"HEALTH_INTERVAL" usage:"Interval in which the postgres and the event sinks are checked."`
+	Timeout  time.Duration `yaml:"timeout" env:"HEALTH_TIMEOUT" usage:"Timeout of a single check."`
+}
+
+type Metrics struct {
+	EntityInterval time.Duration `yaml:"entity_interval" env:"METRICS_ENTITY_INTERVAL" usage:"Interval in which the roles and bindings are counted. 0 disables it."`
+}
+
+type Tracing struct {
+	Exporter     string  `yaml:"exporter" env:"TRACING_EXPORTER" usage:"Exporter of the traces: none, stdout or otlp."`
+	OtlpEndpoint string  `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" usage:"Address of the OTLP gRPC receiver traces are exported to."`
+	OtlpInsecure bool    `yaml:"otlp_insecure" env:"TRACING_OTLP_INSECURE" usage:"Export traces to the OTLP receiver without TLS."`
+	SampleRatio  float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" usage:"Fraction of the traces which are sampled, unless the caller decided."`
+}
+
+type Postgres struct {
+	Host             string        `yaml:"host" env:"POSTGRES_URL" usage:"The url the postgres listens to."`
+	User             string        `yaml:"user" env:"POSTGRES_USER" usage:"The user to connect to the postgres."`
+	Password         string        `yaml:"password" env:"POSTGRES_PASSWORD" secret:"true" usage:"The password to connect to the postgres."`
+	PasswordFile     string        `yaml:"password_file" env:"POSTGRES_PASSWORD_FILE" usage:"File the password to connect to the postgres is read from, instead of the password itself."`
+	Database         string        `yaml:"database" env:"POSTGRES_DB" usage:"The database to connect to the postgres."`
+	Schema           string        `yaml:"schema" env:"POSTGRES_SCHEMA" usage:"The schema to connect to."`
+	MaxOpenConns     int           `yaml:"max_open_conns" env:"POSTGRES_MAX_OPEN_CONNS" usage:"Maximum number of open connections to the postgres."`
+	MaxIdleConns     int           `yaml:"max_idle_conns" env:"POSTGRES_MAX_IDLE_CONNS" usage:"Maximum number of idle connections to the postgres."`
+	ConnMaxLifetime  time.Duration `yaml:"conn_max_lifetime" env:"POSTGRES_CONN_MAX_LIFETIME" usage:"Maximum time a connection to the postgres may be reused."`
+	StatementTimeout time.Duration `yaml:"statement_timeout" env:"POSTGRES_STATEMENT_TIMEOUT" usage:"Statements running longer than this are aborted. 0 disables it."`
+	PingInterval     time.Duration `yaml:"ping_interval" env:"POSTGRES_PING_INTERVAL" usage:"Interval in which the connection to the postgres is checked."`
+}
+
+type Cache struct {
+	Size int           `yaml:"size" env:"CACHE_SIZE" usage:"Maximum number of cached roles and role permissions. 0 disables the cache."`
+	Ttl  time.Duration `yaml:"ttl" env:"CACHE_TTL" usage:"Time after which cached roles and role permissions are read again."`
+}
+
+type Events struct {
+	Sinks                []string      `yaml:"sinks" env:"EVENT_SINKS" usage:"Comma separated list of sinks events are published to: kafka, nats, http, file or stdout."`
+	Source               string        `yaml:"source" env:"CLOUDEVENTS_SOURCE" usage:"CloudEvents source uri."`
+	Encoding             string        `yaml:"encoding" env:"CLOUDEVENTS_ENCODING" usage:"Encoding of the event data: protobuf or protojson."`
+	HttpTarget           string        `yaml:"http_target" env:"HTTP_SINK_TARGET" usage:"URL events are posted to using the CloudEvents HTTP binding."`
+	File                 string        `yaml:"file" env:"EVENT_FILE" usage:"File events are appended to as JSON lines."`
+	RetryAttempts        int           `yaml:"retry_attempts" env:"EVENT_RETRY_ATTEMPTS" usage:"How often sending an event is tried before it is dead-lettered."`
+	RetryInitialInterval time.Duration `yaml:"retry_initial_interval" env:"EVENT_RETRY_INITIAL_INTERVAL" usage:"Delay before the first retry, doubled with every further retry."`
+	RetryMaxInterval     time.Duration `yaml:"retry_max_interval" env:"EVENT_RETRY_MAX_INTERVAL" usage:"Maximum delay between two retries."`
+	DeadLetterTopic      string        `yaml:"dead_letter_topic" env:"DEAD_LETTER_TOPIC" usage:"Kafka topic events are sent to after all retries failed."`
+	DeadLetterFile       string        `yaml:"dead_letter_file" env:"DEAD_LETTER_FILE" usage:"File events are appended to after all retries failed, if no dead-letter topic is set."`
+}
+
+type Kafka struct {
+	Brokers       []string `yaml:"brokers" env:"KAFKA_BROKERS" usage:"Kafka brokers to connect to."`
+	Topic         string   `yaml:"topic" env:"KAFKA_TOPIC" usage:"Kafka topic to send events to."`
+	Structured    bool     `yaml:"structured" env:"KAFKA_STRUCTURED" usage:"Send events to Kafka in structured instead of binary mode."`
+	SnapshotTopic string   `yaml:"snapshot_topic" env:"KAFKA_SNAPSHOT_TOPIC" usage:"Compacted Kafka topic snapshots are published to. Snapshots are disabled if empty."`
+}
+
+type Nats struct {
+	Url     string `yaml:"url" env:"NATS_URL" usage:"NATS server to send events to."`
+	Subject string `yaml:"subject" env:"NATS_SUBJECT" usage:"NATS subject to send events to."`
+}
+
+type Outbox struct {
+	Interval  time.Duration `yaml:"interval" env:"OUTBOX_INTERVAL" usage:"Interval in which pending events are published from the outbox."`
+	BatchSize int           `yaml:"batch_size" env:"OUTBOX_BATCH_SIZE" usage:"Maximum number of events published from the outbox at once."`
+	Retention time.Duration `yaml:"retention" env:"OUTBOX_RETENTION" usage:"How long sent events are kept in the outbox to be watched. 0 keeps them forever."`
+	Lease     time.Duration `yaml:"lease" env:"OUTBOX_LEASE" usage:"How long an instance may take to publish a batch of events, before another instance takes it over."`
+}
+
+type Snapshot struct {
+	Interval     time.Duration `yaml:"interval" env:"SNAPSHOT_INTERVAL" usage:"Interval in which snapshots are published. 0 only publishes them on demand."`
+	IncludeUsers bool          `yaml:"include_users" env:"SNAPSHOT_INCLUDE_USERS" usage:"Include the roles and permissions of all users in the periodic snapshots."`
+}
+
+type Watch struct {
+	PollInterval time.Duration `yaml:"poll_interval" env:"WATCH_POLL_INTERVAL" usage:"Interval in which watch streams check for new events."`
+}
+
+type Webhook struct {
+	Interval time.Duration `yaml:"interval" env:"WEBHOOK_INTERVAL" usage:"Interval in which new events are delivered to the webhooks."`
+	Timeout  time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT" usage:"Timeout of a single webhook request."`
+}
+
+type Accounts struct {
+	Topic            string `yaml:"topic" env:"ACCOUNT_EVENTS_TOPIC" usage:"Kafka topic the account events are consumed from. They are not consumed if empty."`
+	Group            string `yaml:"group" env:"ACCOUNT_EVENTS_GROUP" usage:"Consumer group used to consume the account events."`
+	DeletedEventType string `yaml:"deleted_event_type" env:"ACCOUNT_DELETED_EVENT_TYPE" usage:"Type of the events sent when an account is deleted."`
+	MergedEventType  string `yaml:"merged_event_type" env:"ACCOUNT_MERGED_EVENT_TYPE" usage:"Type of the events sent when an account is merged into another one."`
+}
+
+// Default returns the configuration used for everything that is not set.
+func Default() *Config {
+	return &Config{
+		Port:               6969,
+		ConnectMaxAttempts: 10,
+		ShutdownTimeout:    30 * time.Second,
+		TLS: TLS{
+			ClientAuth:     "none",
+			ReloadInterval: 30 * time.Second,
+		},
+		RateLimit: RateLimit{
+			ReadBurst:  100,
+			WriteBurst: 20,
+		},
+		Log: Log{
+			Level:        "info",
+			Format:       "json",
+			AdminAddress: "localhost:8082",
+		},
+		Health: Health{
+			Port:     8081,
+			Interval: 10 * time.Second,
+			Timeout:  5 * time.Second,
+		},
+		Metrics: Metrics{
+			EntityInterval: time.Minute,
+		},
+		Tracing: Tracing{
+			Exporter:     "none",
+			OtlpEndpoint: "localhost:4317",
+			SampleRatio:  1,
+		},
+		Postgres: Postgres{
+			Host:             "localhost:5432",
+			User:             "test",
+			Password:         "password",
+			Database:         "test_database",
+			Schema:           "public",
+			MaxOpenConns:     20,
+			MaxIdleConns:     5,
+			ConnMaxLifetime:  30 * time.Minute,
+			StatementTimeout: 10 * time.Second,
+			PingInterval:     10 * time.Second,
+		},
+		Cache: Cache{
+			Size: 1024,
+			Ttl:  time.Minute,
+		},
+		Events: Events{
+			Sinks:                []string{"kafka"},
+			Source:               "cow.global.indigo-service",
+			Encoding:             "protobuf",
+			HttpTarget:           "http://127.0.0.1:8080",
+			File:                 "events.jsonl",
+			RetryAttempts:        5,
+			RetryInitialInterval: 200 * time.Millisecond,
+			RetryMaxInterval:     5 * time.Second,
+		},
+		Kafka: Kafka{
+			Brokers: []string{"127.0.0.1:9092"},
+			Topic:   "cow.global.indigo",
+		},
+		Nats: Nats{
+			Url:     "nats://127.0.0.1:4222",
+			Subject: "cow.global.indigo",
+		},
+		Outbox: Outbox{
+			Interval:  500 * time.Millisecond,
+			BatchSize: 100,
+			Retention: 24 * time.Hour,
+			Lease:     5 * time.Minute,
+		},
+		Snapshot: Snapshot{
+			Interval: time.Hour,
+		},
+		Watch: Watch{
+			PollInterval: time.Second,
+		},
+		Webhook: Webhook{
+			Interval: time.Second,
+			Timeout:  10 * time.Second,
+		},
+		Accounts: Accounts{
+			Group:            "indigo",
+			DeletedEventType: "cow.account.v1.AccountDeletedEvent",
+			MergedEventType:  "cow.account.v1.AccountMergedEvent",
+		},
+	}
+}
+
+// Validate returns an error listing everything that is wrong with c.
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "port must be between 1 and 65535, got %d", c.Port)
+	check(c.ConnectMaxAttempts >= 0, "connect_max_attempts must not be negative")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+
+	if len(c.TLS.CertFile) > 0 {
+		check(len(c.TLS.KeyFile) > 0, "tls.key_file must be set if tls.cert_file is set")
+		check(c.TLS.ReloadInterval > 0, "tls.reload_interval must be positive")
+	}
+	switch c.TLS.ClientAuth {
+	case "none":
+	case "request", "require":
+		check(len(c.TLS.CertFile) > 0, "tls.client_auth %q requires tls.cert_file", c.TLS.ClientAuth)
+		check(len(c.TLS.ClientCAFile) > 0, "tls.client_auth %q requires tls.client_ca_file", c.TLS.ClientAuth)
+	default:
+		check(false, "tls.client_auth must be none, request or require, got %q", c.TLS.ClientAuth)
+	}
+
+	check(!c.Auth.Required || len(c.Auth.APIKeys) > 0 || len(c.Auth.JWKSFile) > 0 || c.TLS.ClientAuth != "none",
+		"auth.required needs auth.api_keys, auth.jwks_file or tls.client_auth to be set")
+
+	check(!c.Authz.Enabled || len(c.Auth.APIKeys) > 0 || len(c.Auth.JWKSFile) > 0 || c.TLS.ClientAuth != "none",
+		"authz.enabled needs auth.api_keys, auth.jwks_file or tls.client_auth to be set")
+	if len(c.Authz.Superuser) > 0 {
+		_, err := uuid.Parse(c.Authz.Superuser)
+		check(err == nil, "authz.superuser must be an account id, got %q", c.Authz.Superuser)
+	}
+
+	check(c.RateLimit.ReadRate >= 0, "rate_limit.read_rate must not be negative")
+	check(c.RateLimit.ReadRate == 0 || c.RateLimit.ReadBurst > 0, "rate_limit.read_burst must be positive")
+	check(c.RateLimit.WriteRate >= 0, "rate_limit.write_rate must not be negative")
+	check(c.RateLimit.WriteRate == 0 || c.RateLimit.WriteBurst > 0, "rate_limit.write_burst must be positive")
+	check(c.RateLimit.MaxConcurrent >= 0, "rate_limit.max_concurrent must not be negative")
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text, got %q", c.Log.Format)
+	if len(c.Log.AdminAddress) > 0 {
+		_, _, err := net.SplitHostPort(c.Log.AdminAddress)
+		check(err == nil, "log.admin_address must be host:port, got %q", c.Log.AdminAddress)
+	}
+
+	check(c.Health.Port >= 0 && c.Health.Port < 65536, "health.port must be between 0 and 65535, got %d", c.Health.Port)
+	check(c.Health.Port != c.Port, "health.port must differ from port")
+	check(c.Health.Interval > 0, "health.interval must be positive")
+	check(c.Health.Timeout > 0, "health.timeout must be positive")
+
+	check(c.Metrics.EntityInterval >= 0, "metrics.entity_interval must not be negative")
+
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "stdout" || c.Tracing.Exporter == "otlp",
+		"tracing.exporter must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(len(c.Postgres.Host) > 0, "postgres.host must be set")
+	check(len(c.Postgres.Database) > 0, "postgres.database must be set")
+	check(c.Postgres.MaxOpenConns > 0, "postgres.max_open_conns must be positive")
+	check(c.Postgres.MaxIdleConns >= 0 && c.Postgres.MaxIdleConns <= c.Postgres.MaxOpenConns,
+		"postgres.max_idle_conns must be between 0 and postgres.max_open_conns (%d)", c.Postgres.MaxOpenConns)
+	check(c.Postgres.StatementTimeout >= 0, "postgres.statement_timeout must not be negative")
+	check(c.Postgres.PingInterval > 0, "postgres.ping_interval must be positive")
+
+	check(c.Cache.Size >= 0, "cache.size must not be negative")
+	check(c.Cache.Ttl >= 0, "cache.ttl must not be negative")
+
+	check(len(c.Events.Sinks) > 0, "events.sinks must contain at least one sink")
+	for _, name := range c.Events.Sinks {
+		switch name {
+		case "kafka", "nats", "http", "file", "stdout":
+		default:
+			check(false, "events.sinks contains unknown sink %q, expected kafka, nats, http, file or stdout", name)
+		}
+	}
+	check(c.Events.Encoding == "protobuf" || c.Events.Encoding == "protojson",
+		"events.encoding must be protobuf or protojson, got %q", c.Events.Encoding)
+	check(c.Events.RetryAttempts > 0, "events.retry_attempts must be positive")
+	check(c.Events.RetryInitialInterval > 0, "events.retry_initial_interval must be positive")
+	check(c.Events.RetryMaxInterval >= c.Events.RetryInitialInterval,
+		"events.retry_max_interval must not be less than events.retry_initial_interval")
+
+	check(len(c.Kafka.Brokers) > 0, "kafka.brokers must contain at least one broker")
+
+	check(c.Outbox.Interval > 0, "outbox.interval must be positive")
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+	check(c.Outbox.Retention >= 0, "outbox.retention must not be negative")
+	check(c.Outbox.Lease > 0, "outbox.lease must be positive")
+	check(c.Snapshot.Interval >= 0, "snapshot.interval must not be negative")
+	check(c.Watch.PollInterval > 0, "watch.poll_interval must be positive")
+	check(c.Webhook.Interval > 0, "webhook.interval must be positive")
+	check(c.Webhook.Timeout > 0, "webhook.timeout must be positive")
+
+	if len(c.Accounts.Topic) > 0 {
+		check(len(c.Accounts.Group) > 0, "accounts.group must be set if accounts.topic is set")
+		check(len(c.Accounts.DeletedEventType) > 0 && len(c.Accounts.MergedEventType) > 0,
+			"accounts.deleted_event_type and accounts.merged_event_type must be set if accounts.topic is set")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// readPasswordFile replaces the postgres password with the
+// content of the password file, if one has been configured.
+func (c *Config) readPasswordFile() error {
+	if len(c.Postgres.PasswordFile) == 0 {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(c.Postgres.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("could not read postgres.password_file: %v", err)
+	}
+	c.Postgres.Password = strings.TrimRight(string(b), "\r\n")
+	return nil
+}
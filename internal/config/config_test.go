@@ -0,0 +1,125 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		errs   []string
+	}{
+		{
+			name:   "default",
+			modify: func(c *Config) {},
+		},
+		{
+			name: "port",
+			modify: func(c *Config) {
+				c.Port = 70000
+			},
+			errs: []string{"port must be between 1 and 65535, got 70000"},
+		},
+		{
+			name: "same health port",
+			modify: func(c *Config) {
+				c.Health.Port = c.Port
+			},
+			errs: []string{"health.port must differ from port"},
+		},
+		{
+			name: "client auth without certificate",
+			modify: func(c *Config) {
+				c.TLS.ClientAuth = "require"
+			},
+			errs: []string{
+				`tls.client_auth "require" requires tls.cert_file`,
+				`tls.client_auth "require" requires tls.client_ca_file`,
+			},
+		},
+		{
+			name: "auth required without credentials",
+			modify: func(c *Config) {
+				c.Auth.Required = true
+			},
+			errs: []string{"auth.required needs auth.api_keys, auth.jwks_file or tls.client_auth to be set"},
+		},
+		{
+			name: "superuser",
+			modify: func(c *Config) {
+				c.Auth.APIKeys = []string{"lobby:key"}
+				c.Authz.Enabled = true
+				c.Authz.Superuser = "lobby"
+			},
+			errs: []string{`authz.superuser must be an account id, got "lobby"`},
+		},
+		{
+			name: "rate limit without burst",
+			modify: func(c *Config) {
+				c.RateLimit.ReadRate = 10
+				c.RateLimit.ReadBurst = 0
+			},
+			errs: []string{"rate_limit.read_burst must be positive"},
+		},
+		{
+			name: "admin address",
+			modify: func(c *Config) {
+				c.Log.AdminAddress = "localhost"
+			},
+			errs: []string{`log.admin_address must be host:port, got "localhost"`},
+		},
+		{
+			name: "unknown sink",
+			modify: func(c *Config) {
+				c.Events.Sinks = []string{"kafka", "memory"}
+			},
+			errs: []string{`events.sinks contains unknown sink "memory"`},
+		},
+		{
+			name: "no retry attempts",
+			modify: func(c *Config) {
+				c.Events.RetryAttempts = 0
+			},
+			errs: []string{"events.retry_attempts must be positive"},
+		},
+		{
+			name: "several errors",
+			modify: func(c *Config) {
+				c.Outbox.Lease = 0
+				c.Log.Level = "verbose"
+			},
+			errs: []string{
+				`log.level must be debug, info, warn or error, got "verbose"`,
+				"outbox.lease must be positive",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := Default()
+			test.modify(c)
+			err := c.Validate()
+
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Fatalf("Validate failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate succeeded, want %q", test.errs)
+			}
+			for _, e := range test.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("Validate returned %v, want %q", err, e)
+				}
+			}
+			if n := strings.Count(err.Error(), "\n  "); n != len(test.errs) {
+				t.Errorf("Validate returned %d errors, want %d: %v", n, len(test.errs), err)
+			}
+		})
+	}
+}
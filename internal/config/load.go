@@ -0,0 +1,226 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EnvPrefix = "INDIGO_SERVICE_"
+	// ConfigFileEnv names the configuration file, if it is not passed as flag.
+	ConfigFileEnv = EnvPrefix + "CONFIG"
+
+	redacted = "<redacted>"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load reads the configuration, with flags taking precedence over
+// environment variables, which take precedence over the configuration
+// file, which takes precedence over the defaults. The configuration is
+// validated, unless the returned printConfig is set.
+func Load(name string, args []string) (c *Config, printConfig bool, err error) {
+	c = Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(ConfigFileEnv), "YAML configuration file. Also read from "+ConfigFileEnv+".")
+	fs.BoolVar(&printConfig, "print-config", false, "Print the configuration with secrets redacted and exit.")
+
+	// flags are applied last, but have to be parsed first to know the file
+	var setFlags []func() error
+	walk(c, func(key string, field reflect.StructField, v reflect.Value) {
+		f := &fieldFlag{isBool: v.Kind() == reflect.Bool}
+		f.set = func(s string) error {
+			setFlags = append(setFlags, func() error {
+				if err := setValue(v, s); err != nil {
+					return fmt.Errorf("invalid value of flag -%s: %v", key, err)
+				}
+				return nil
+			})
+			return nil
+		}
+		fs.Var(f, key, field.Tag.Get("usage")+" ("+EnvPrefix+field.Tag.Get("env")+")")
+	})
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	if len(*configFile) > 0 {
+		if err := c.readFile(*configFile); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var errs []error
+	walk(c, func(key string, field reflect.StructField, v reflect.Value) {
+		env := EnvPrefix + field.Tag.Get("env")
+		if value, ok := os.LookupEnv(env); ok && len(value) > 0 {
+			if err := setValue(v, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value of %s: %v", env, err))
+			}
+		}
+	})
+	for _, set := range setFlags {
+		if err := set(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, false, errs[0]
+	}
+
+	if err := c.readPasswordFile(); err != nil {
+		return nil, false, err
+	}
+	if printConfig {
+		return c, true, nil
+	}
+	return c, false, c.Validate()
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open configuration file: %v", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("could not read configuration file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Print writes c as YAML to w, with secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{}
+	walk(c, func(key string, field reflect.StructField, v reflect.Value) {
+		parent := root
+		if i := strings.LastIndexByte(key, '.'); i >= 0 {
+			section := key[:i]
+			if sections[section] == nil {
+				sections[section] = &yaml.Node{Kind: yaml.MappingNode}
+				root.Content = append(root.Content, scalarNode(section), sections[section])
+			}
+			parent = sections[section]
+		}
+		parent.Content = append(parent.Content, scalarNode(field.Tag.Get("yaml")), valueNode(field, v))
+	})
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(root)
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+func valueNode(field reflect.StructField, v reflect.Value) *yaml.Node {
+	if field.Tag.Get("secret") == "true" && v.Len() > 0 {
+		return scalarNode(redacted)
+	}
+	if v.Type() == durationType {
+		return scalarNode(v.Interface().(time.Duration).String())
+	}
+
+	n := &yaml.Node{}
+	_ = n.Encode(v.Interface())
+	if n.Kind == yaml.SequenceNode {
+		n.Style = yaml.FlowStyle
+	}
+	return n
+}
+
+// walk calls fn for every configurable field of c, with
+// the dotted yaml keys of the field and its sections.
+func walk(c *Config, fn func(key string, field reflect.StructField, v reflect.Value)) {
+	var walkStruct func(prefix string, v reflect.Value)
+	walkStruct = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+				walkStruct(key+".", v.Field(i))
+				continue
+			}
+			fn(key, field, v.Field(i))
+		}
+	}
+	walkStruct("", reflect.ValueOf(c).Elem())
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(i))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var values []string
+		for _, value := range strings.Split(s, ",") {
+			if value = strings.TrimSpace(value); len(value) > 0 {
+				values = append(values, value)
+			}
+		}
+		v.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// fieldFlag is the flag.Value of a configuration field.
+type fieldFlag struct {
+	isBool bool
+	set    func(string) error
+}
+
+func (f *fieldFlag) String() string {
+	return ""
+}
+
+func (f *fieldFlag) Set(s string) error {
+	return f.set(s)
+}
+
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.isBool
+}
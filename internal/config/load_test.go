@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setenv sets the environment variable for the duration of the test.
+func setenv(t *testing.T, key string, value string) {
+	t.Helper()
+	prev, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, prev)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// writeFile writes content to a file in a temporary directory.
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		check func(c *Config) interface{}
+		want  interface{}
+	}{
+		{
+			name:  "default",
+			check: func(c *Config) interface{} { return c.Port },
+			want:  6969,
+		},
+		{
+			name:  "file",
+			file:  "port: 1000",
+			check: func(c *Config) interface{} { return c.Port },
+			want:  1000,
+		},
+		{
+			name:  "env over file",
+			file:  "port: 1000",
+			env:   map[string]string{"INDIGO_SERVICE_PORT": "2000"},
+			check: func(c *Config) interface{} { return c.Port },
+			want:  2000,
+		},
+		{
+			name:  "flag over env",
+			file:  "port: 1000",
+			env:   map[string]string{"INDIGO_SERVICE_PORT": "2000"},
+			args:  []string{"--port", "3000"},
+			check: func(c *Config) interface{} { return c.Port },
+			want:  3000,
+		},
+		{
+			name:  "empty env is ignored",
+			file:  "port: 1000",
+			env:   map[string]string{"INDIGO_SERVICE_PORT": ""},
+			check: func(c *Config) interface{} { return c.Port },
+			want:  1000,
+		},
+		{
+			name:  "nested key",
+			file:  "outbox:\n  lease: 1m",
+			args:  []string{"--outbox.batch_size", "7"},
+			check: func(c *Config) interface{} { return []interface{}{c.Outbox.Lease.String(), c.Outbox.BatchSize} },
+			want:  []interface{}{"1m0s", 7},
+		},
+		{
+			name:  "comma separated list",
+			file:  "events:\n  sinks: [kafka]",
+			env:   map[string]string{"INDIGO_SERVICE_EVENT_SINKS": "nats, file"},
+			check: func(c *Config) interface{} { return c.Events.Sinks },
+			want:  []string{"nats", "file"},
+		},
+		{
+			name:  "env only overrides its key",
+			env:   map[string]string{"INDIGO_SERVICE_POSTGRES_DB": "from_env"},
+			file:  "postgres:\n  database: from_file\n  schema: from_file",
+			check: func(c *Config) interface{} { return []string{c.Postgres.Database, c.Postgres.Schema} },
+			want:  []string{"from_env", "from_file"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := test.args
+			if len(test.file) > 0 {
+				args = append([]string{"--config", writeFile(t, "indigo.yaml", test.file)}, args...)
+			}
+			for key, value := range test.env {
+				setenv(t, key, value)
+			}
+
+			c, _, err := Load("indigo", args)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if got := test.check(c); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		err  string
+	}{
+		{
+			name: "unknown key in file",
+			file: "prot: 1000",
+			err:  "field prot not found",
+		},
+		{
+			name: "invalid env",
+			env:  map[string]string{"INDIGO_SERVICE_PORT": "many"},
+			err:  "invalid value of INDIGO_SERVICE_PORT",
+		},
+		{
+			name: "invalid flag",
+			args: []string{"--outbox.lease", "long"},
+			err:  "invalid value of flag -outbox.lease",
+		},
+		{
+			name: "invalid value",
+			args: []string{"--port", "0"},
+			err:  "port must be between 1 and 65535, got 0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := test.args
+			if len(test.file) > 0 {
+				args = append([]string{"--config", writeFile(t, "indigo.yaml", test.file)}, args...)
+			}
+			for key, value := range test.env {
+				setenv(t, key, value)
+			}
+
+			_, _, err := Load("indigo", args)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Load returned %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestLoadPasswordFile(t *testing.T) {
+	path := writeFile(t, "password", "hunter2\n")
+	c, _, err := Load("indigo", []string{"--postgres.password", "ignored", "--postgres.password_file", path})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if c.Postgres.Password != "hunter2" {
+		t.Errorf("password is %q, want hunter2", c.Postgres.Password)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	c := Default()
+	c.Postgres.Password = "hunter2"
+	c.Auth.APIKeys = []string{"lobby:secret-key"}
+
+	var buf bytes.Buffer
+	if err := c.Print(&buf); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "secret-key"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printed configuration contains %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "password: "+redacted) || !strings.Contains(out, "api_keys: "+redacted) {
+		t.Errorf("printed configuration does not redact the secrets:\n%s", out)
+	}
+	if !strings.Contains(out, "user: test") {
+		t.Errorf("printed configuration misses the postgres user:\n%s", out)
+	}
+
+	// empty secrets are printed, so that it is visible they are not set
+	c.Auth.APIKeys = nil
+	buf.Reset()
+	if err := c.Print(&buf); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "api_keys: "+redacted) {
+		t.Errorf("printed configuration redacts empty api keys:\n%s", buf.String())
+	}
+}
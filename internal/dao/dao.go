@@ -1,23 +1,75 @@
 package dao
 
 import (
+	"context"
 	"github.com/cownetwork/indigo/internal/model"
 	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"time"
 )
 
 type DataAccessor interface {
-	ListRoles() ([]*model.Role, error)
-	InsertRole(role *model.Role) error
-	UpdateRole(roleId *pb.RoleIdentifier, role *model.Role) error
-	GetRole(roleId *pb.RoleIdentifier) (*model.Role, error)
-	DeleteRole(roleId string) error
-	GetRolePermissions(roleId string) ([]*model.RolePermissionBinding, error)
-	AddRolePermissions(roleId string, permissions []string) ([]string, error)
-	RemoveRolePermissions(roleId string, permissions []string) ([]string, error)
-	GetUserRoleBindings(userAccountId string) ([]*model.UserRoleBinding, error)
-	AddUserRoles(userAccountId string, roleIds []string) ([]string, error)
-	RemoveUserRoles(userAccountId string, roleIds []string) ([]string, error)
-	GetUserPermissions(userAccountId string) ([]*model.UserPermissionBinding, error)
-	AddUserPermissions(userAccountId string, permissions []string) ([]string, error)
-	RemoveUserPermissions(userAccountId string, permissions []string) ([]string, error)
+	// Tx runs fn in a transaction, which is committed if fn returns
+	// nil and rolled back otherwise. The DataAccessor passed to fn
+	// must be used for everything that belongs to the transaction.
+	Tx(ctx context.Context, fn func(tx DataAccessor) error) error
+	// ReadTx runs fn in a read-only transaction, in which
+	// every read sees the same snapshot of the database.
+	ReadTx(ctx context.Context, fn func(tx DataAccessor) error) error
+	ListRoles(ctx context.Context) ([]*model.Role, error)
+	InsertRole(ctx context.Context, role *model.Role) error
+	UpdateRole(ctx context.Context, roleId *pb.RoleIdentifier, role *model.Role) error
+	GetRole(ctx context.Context, roleId *pb.RoleIdentifier) (*model.Role, error)
+	DeleteRole(ctx context.Context, roleId string) error
+	GetRolePermissions(ctx context.Context, roleId string) ([]*model.RolePermissionBinding, error)
+	AddRolePermissions(ctx context.Context, roleId string, permissions []string) ([]string, error)
+	RemoveRolePermissions(ctx context.Context, roleId string, permissions []string) ([]string, error)
+	GetUserRoleBindings(ctx context.Context, userAccountId string) ([]*model.UserRoleBinding, error)
+	GetRoleUserBindings(ctx context.Context, roleId string) ([]*model.UserRoleBinding, error)
+	AddUserRoles(ctx context.Context, userAccountId string, roleIds []string) ([]string, error)
+	RemoveUserRoles(ctx context.Context, userAccountId string, roleIds []string) ([]string, error)
+	GetUserPermissions(ctx context.Context, userAccountId string) ([]*model.UserPermissionBinding, error)
+	AddUserPermissions(ctx context.Context, userAccountId string, permissions []string) ([]string, error)
+	RemoveUserPermissions(ctx context.Context, userAccountId string, permissions []string) ([]string, error)
+	ListRolePermissionBindings(ctx context.Context) ([]*model.RolePermissionBinding, error)
+	ListUserRoleBindings(ctx context.Context) ([]*model.UserRoleBinding, error)
+	ListUserPermissionBindings(ctx context.Context) ([]*model.UserPermissionBinding, error)
+	CountEntities(ctx context.Context) (*model.EntityCounts, error)
+	InsertOutboxEvent(ctx context.Context, event *model.OutboxEvent) error
+	// NextEventSequence increments and returns the sequence number of the entity.
+	NextEventSequence(ctx context.Context, entity string) (int64, error)
+	ListEventSequences(ctx context.Context) ([]*model.EventSequence, error)
+	// GetPendingOutboxEvents returns the oldest events that have not been
+	// sent yet and locks them until the surrounding transaction ends.
+	GetPendingOutboxEvents(ctx context.Context, limit int) ([]*model.OutboxEvent, error)
+	// ClaimOutboxEvents marks the events as being sent until the given time.
+	ClaimOutboxEvents(ctx context.Context, ids []int64, until time.Time) error
+	// ReleaseOutboxEvents removes the claims of the events which are not sent.
+	ReleaseOutboxEvents(ctx context.Context, ids []int64) error
+	MarkOutboxEventSent(ctx context.Context, id int64) error
+	MarkOutboxEventDead(ctx context.Context, id int64, attempts int, reason string) error
+	GetDeadOutboxEvents(ctx context.Context, limit int) ([]*model.OutboxEvent, error)
+	// RedriveOutboxEvents makes the given dead events pending again.
+	// If no ids are given, all dead events are re-driven.
+	RedriveOutboxEvents(ctx context.Context, ids []int64) (int64, error)
+	// GetOutboxEventsAfter returns the relayed events matching
+	// filter with a position after the given one, in order.
+	GetOutboxEventsAfter(ctx context.Context, position int64, filter model.OutboxFilter, limit int) ([]*model.OutboxEvent, error)
+	GetLatestOutboxPosition(ctx context.Context) (int64, error)
+	// GetOutboxHorizon returns the highest position of the events which
+	// have been deleted from the outbox. Events up to it are gone.
+	GetOutboxHorizon(ctx context.Context) (int64, error)
+	// DeleteSentOutboxEvents deletes the events sent before the given
+	// time, up to maxPosition, and moves the horizon accordingly.
+	DeleteSentOutboxEvents(ctx context.Context, before time.Time, maxPosition int64) (int64, error)
+
+	InsertWebhook(ctx context.Context, webhook *model.Webhook) error
+	ListWebhooks(ctx context.Context) ([]*model.Webhook, error)
+	// ClaimWebhook claims the webhook until the given time and returns it,
+	// or returns nil if it does not exist or is claimed by another instance.
+	ClaimWebhook(ctx context.Context, id string, until time.Time) (*model.Webhook, error)
+	// UpdateWebhookStatus stores the delivery status of the webhook and
+	// moves its claim to claimedUntil, or releases it if that is nil. It
+	// returns false if the webhook is not claimed as in webhook anymore.
+	UpdateWebhookStatus(ctx context.Context, webhook *model.Webhook, claimedUntil *time.Time) (bool, error)
+	DeleteWebhook(ctx context.Context, id string) (bool, error)
 }
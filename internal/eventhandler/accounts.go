@@ -0,0 +1,111 @@
+package eventhandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/cloudevents/sdk-go/protocol/kafka_sarama/v2"
+	"github.com/cownetwork/indigo/internal/backoff"
+	"github.com/cownetwork/indigo/internal/logging"
+	"github.com/cownetwork/indigo/internal/reqmeta"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// AccountHandler cleans up the data of accounts which
+// have been deleted or merged by the account service.
+type AccountHandler interface {
+	DeleteAccount(ctx context.Context, accountId string) error
+	// MergeAccount moves the data of accountId to targetAccountId.
+	MergeAccount(ctx context.Context, accountId string, targetAccountId string) error
+}
+
+// AccountConsumerConfig describes where the account events are
+// consumed from and which event types they are sent with.
+type AccountConsumerConfig struct {
+	Brokers          []string
+	Topic            string
+	ConsumerGroup    string
+	DeletedEventType string
+	MergedEventType  string
+}
+
+// accountEventData is the data of the account events. The subject
+// of the event is used if the account id is missing.
+type accountEventData struct {
+	AccountId       string `json:"account_id"`
+	TargetAccountId string `json:"target_account_id"`
+}
+
+// RunAccountConsumer consumes the account events described by c and
+// passes them to h, until ctx is done. Handling an event is retried
+// as configured for sending events, before it is given up on.
+func RunAccountConsumer(ctx context.Context, c AccountConsumerConfig, h AccountHandler) error {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Version = sarama.V2_0_0_0
+
+	consumer, err := kafka_sarama.NewConsumer(c.Brokers, saramaConfig, c.ConsumerGroup, c.Topic)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close(context.Background())
+
+	client, err := cloudevents.NewClient(consumer)
+	if err != nil {
+		return err
+	}
+
+	return client.StartReceiver(ctx, func(ctx context.Context, event cloudevents.Event) {
+		if event.Type() != c.DeletedEventType && event.Type() != c.MergedEventType {
+			return
+		}
+
+		// the changes are attributed to the account event
+		ctx = reqmeta.NewContext(ctx, &reqmeta.Meta{
+			RequestId: event.ID(),
+			Actor:     event.Source(),
+		})
+		ctx = logging.NewContext(ctx,
+			zap.String("request_id", event.ID()),
+			zap.String("event_type", event.Type()),
+		)
+
+		data, err := parseAccountEvent(event, event.Type() == c.MergedEventType)
+		if err != nil {
+			logging.FromContext(ctx).Error("Dropping malformed account event", zap.Error(err))
+			return
+		}
+		ctx = logging.NewContext(ctx, zap.String("account_id", data.AccountId))
+		err = backoff.Retry(ctx, retryConfig, func(int) error {
+			if event.Type() == c.DeletedEventType {
+				return h.DeleteAccount(ctx, data.AccountId)
+			}
+			return h.MergeAccount(ctx, data.AccountId, data.TargetAccountId)
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("Could not handle account event", zap.Error(err))
+		}
+	})
+}
+
+func parseAccountEvent(event cloudevents.Event, merged bool) (*accountEventData, error) {
+	var data accountEventData
+	if len(event.Data()) > 0 {
+		if err := json.Unmarshal(event.Data(), &data); err != nil {
+			return nil, err
+		}
+	}
+	if len(data.AccountId) == 0 {
+		data.AccountId = event.Subject()
+	}
+	if _, err := uuid.Parse(data.AccountId); err != nil {
+		return nil, fmt.Errorf("invalid account id %q", data.AccountId)
+	}
+	if _, err := uuid.Parse(data.TargetAccountId); merged && err != nil {
+		return nil, fmt.Errorf("invalid target account id %q", data.TargetAccountId)
+	}
+	return &data, nil
+}
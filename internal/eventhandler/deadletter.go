@@ -0,0 +1,28 @@
+package eventhandler
+
+import (
+	"context"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// deadLetter receives the events that could not be sent. It
+// is nil if no dead-letter destination has been configured.
+var deadLetter Sink
+
+// SetDeadLetterSink makes events that could not be
+// sent after all retries be published to s.
+func SetDeadLetterSink(s Sink) {
+	deadLetter = s
+}
+
+// sendDeadLetter publishes a copy of event, annotated with why
+// it could not be sent, to the dead-letter destination.
+func sendDeadLetter(ctx context.Context, event cloudevents.Event, attempts int, reason error) error {
+	e := event.Clone()
+	e.SetExtension("deadletterreason", reason.Error())
+	e.SetExtension("deadletterattempts", attempts)
+	e.SetExtension("deadlettertime", time.Now())
+	return deadLetter.Send(ctx, e)
+}
@@ -2,98 +2,257 @@ package eventhandler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/Shopify/sarama"
-	"github.com/cloudevents/sdk-go/protocol/kafka_sarama/v2"
+	"github.com/cownetwork/indigo/internal/backoff"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/logging"
+	"github.com/cownetwork/indigo/internal/metrics"
+	"github.com/cownetwork/indigo/internal/model"
+	"github.com/cownetwork/indigo/internal/reqmeta"
 	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
-	"log"
+	"strings"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 )
 
+const (
+	RoleUpdateEventType           = "cow.indigo.v1.RoleUpdateEvent"
+	UserPermissionUpdateEventType = "cow.indigo.v1.UserPermissionUpdateEvent"
+
+	// SequenceExtension contains the sequence
+	// number of the event for its subject.
+	SequenceExtension = "sequence"
+
+	EncodingProtobuf  = "protobuf"
+	EncodingProtoJson = "protojson"
+)
+
 var (
-	client    cloudevents.Client
-	sourceUri string
+	sink        Sink
+	sourceUri   string
+	encoding    = EncodingProtobuf
+	retryConfig = backoff.Config{MaxAttempts: 1}
 )
 
-func Initialize(brokers []string, topic string, source string) (*kafka_sarama.Sender, error) {
+// Initialize makes all events be published to s
+// with source as CloudEvents source uri.
+func Initialize(s Sink, source string) {
+	sink = s
 	sourceUri = source
+}
 
-	saramaConfig := sarama.NewConfig()
-	saramaConfig.Version = sarama.V2_0_0_0
-
-	sender, err := kafka_sarama.NewSender(brokers, saramaConfig, topic)
-	if err != nil {
-		return nil, err
-	}
-
-	c, err := cloudevents.NewClient(sender, cloudevents.WithTimeNow(), cloudevents.WithUUIDs())
-	if err != nil {
-		return nil, err
+// SetEncoding sets how the data of the events is encoded. It
+// is either EncodingProtobuf (default) or EncodingProtoJson.
+func SetEncoding(enc string) error {
+	if enc != EncodingProtobuf && enc != EncodingProtoJson {
+		return fmt.Errorf("unknown encoding %q", enc)
 	}
-
-	client = c
-	return sender, nil
+	encoding = enc
+	return nil
 }
 
-func SendEvent(etype string, message proto.Message) error {
+// NewEvent creates a CloudEvent of the given type carrying message as data.
+func NewEvent(etype string, message proto.Message) (cloudevents.Event, error) {
 	event := cloudevents.NewEvent()
 
 	uid, err := uuid.NewUUID()
 	if err != nil {
-		return err
+		return event, err
 	}
 
 	event.SetID(uid.String())
+	event.SetTime(time.Now())
 	event.SetSource(sourceUri)
 	event.SetType(etype)
+	// identifies the message type for consumers that decode the data
+	event.SetDataSchema("proto:" + string(proto.MessageName(message)))
 
-	data, err := proto.Marshal(message)
+	var contentType string
+	var data []byte
+	switch encoding {
+	case EncodingProtoJson:
+		contentType = cloudevents.ApplicationJSON
+		data, err = protojson.Marshal(message)
+	default:
+		contentType = "application/protobuf"
+		data, err = proto.Marshal(message)
+	}
 	if err != nil {
-		return err
+		return event, err
 	}
 
-	err = event.SetData("application/protobuf", data)
-	if err != nil {
+	err = event.SetData(contentType, data)
+	return event, err
+}
+
+// ConfigureRetries sets how often and with which delays
+// SendEvent tries to send an event before it gives up.
+func ConfigureRetries(c backoff.Config) {
+	retryConfig = c
+}
+
+// SendEvent sends the event, retrying as configured by ConfigureRetries.
+func SendEvent(ctx context.Context, event cloudevents.Event) error {
+	return sendWithRetries(ctx, sink, event)
+}
+
+func sendWithRetries(ctx context.Context, s Sink, event cloudevents.Event) error {
+	ctx, span := startSendSpan(ctx, &event)
+	start := time.Now()
+	err := backoff.Retry(ctx, retryConfig, func(attempt int) error {
+		err := send(ctx, s, event)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Could not send CloudEvent",
+				zap.String("event_id", event.ID()), zap.Int("attempt", attempt), zap.Error(err))
+		}
+		// don't send the event twice to the sinks which accepted it
+		if fanOut, ok := err.(*FanOutError); ok {
+			s = fanOut.Failed
+		}
 		return err
+	})
+
+	metrics.EventSendDuration.WithLabelValues(event.Type()).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "failure"
 	}
+	metrics.EventsSent.WithLabelValues(event.Type(), result).Inc()
+	endSendSpan(span, err)
+	return err
+}
 
+func send(ctx context.Context, s Sink, event cloudevents.Event) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("Panic while sending CloudEvent %v: %v", message, r)
+			logging.FromContext(ctx).Error("Panic while sending CloudEvent",
+				zap.String("event_id", event.ID()), zap.Any("panic", r), zap.Stack("stack"))
+			err = fmt.Errorf("panic while sending: %v", r)
 		}
 	}()
 
-	if result := client.Send(
-		// Set the producer message key
-		kafka_sarama.WithMessageKey(context.Background(), sarama.StringEncoder(event.ID())),
-		event,
-	); cloudevents.IsUndelivered(result) {
-		return fmt.Errorf("failed to send: %v", result)
-	}
-	return nil
+	return s.Send(ctx, event)
 }
 
-func SendRoleUpdateEvent(role *pb.Role, action pb.RoleUpdateEvent_Action) {
-	err := SendEvent("cow.indigo.v1.RoleUpdateEvent", &pb.RoleUpdateEvent{
-		Role:   role,
-		Action: action,
-	})
+// QueueEvent writes the event about the entity subject into the outbox of da,
+// from which it is published by the relay once the surrounding transaction
+// is committed. The subject is used as partition key, so that all events of
+// an entity keep their order, and every event gets the next sequence number
+// of the entity, so that consumers can detect missed and stale events.
+// The actor and request id of the request ctx belongs to are added as
+// extensions, just as the given extensions.
+func QueueEvent(ctx context.Context, da dao.DataAccessor, etype string, subject string, message proto.Message, extensions map[string]interface{}) error {
+	event, err := NewEvent(etype, message)
+	if err != nil {
+		return err
+	}
+
+	seq, err := da.NextEventSequence(ctx, sequenceEntity(etype, subject))
+	if err != nil {
+		return err
+	}
+
+	event.SetSubject(subject)
+	event.SetExtension(PartitionKeyExtension, subject)
+	event.SetExtension(SequenceExtension, formatSequence(seq))
+
+	meta := reqmeta.FromContext(ctx)
+	if len(meta.Actor) > 0 {
+		event.SetExtension("actor", meta.Actor)
+	}
+	if len(meta.RequestId) > 0 {
+		event.SetExtension("correlationid", meta.RequestId)
+	}
+	for name, value := range extensions {
+		event.SetExtension(name, value)
+	}
+	injectTraceContext(ctx, &event)
 
+	payload, err := json.Marshal(event)
 	if err != nil {
-		log.Printf("Could not send cloudevent: %v", err)
+		return err
+	}
+
+	return da.InsertOutboxEvent(ctx, &model.OutboxEvent{
+		Type:    etype,
+		Subject: subject,
+		Payload: payload,
+	})
+}
+
+// RoleDiff describes what changed with a role.
+type RoleDiff struct {
+	// Previous is the role before it has been updated.
+	Previous           *pb.Role
+	AddedPermissions   []string
+	RemovedPermissions []string
+}
+
+func (d RoleDiff) extensions() map[string]interface{} {
+	ext := map[string]interface{}{}
+	setListExtension(ext, "addedperms", d.AddedPermissions)
+	setListExtension(ext, "removedperms", d.RemovedPermissions)
+	if d.Previous != nil {
+		ext["prevname"] = d.Previous.Name
+		ext["prevtype"] = d.Previous.Type
+		ext["prevpriority"] = d.Previous.Priority
+		ext["prevtransient"] = d.Previous.Transient
+		ext["prevcolor"] = d.Previous.Color
 	}
+	return ext
 }
 
-func SendUserPermUpdateEvent(user *pb.User, action pb.UserPermissionUpdateEvent_Action) {
-	err := SendEvent("cow.indigo.v1.UserPermissionUpdateEvent", &pb.UserPermissionUpdateEvent{
+// UserDiff describes what changed with the roles and permissions of a user.
+type UserDiff struct {
+	AddedRoles         []string
+	RemovedRoles       []string
+	AddedPermissions   []string
+	RemovedPermissions []string
+}
+
+func (d UserDiff) extensions() map[string]interface{} {
+	ext := map[string]interface{}{}
+	setListExtension(ext, "addedroles", d.AddedRoles)
+	setListExtension(ext, "removedroles", d.RemovedRoles)
+	setListExtension(ext, "addedperms", d.AddedPermissions)
+	setListExtension(ext, "removedperms", d.RemovedPermissions)
+	return ext
+}
+
+// setListExtension sets the extension to the comma separated list of
+// values, which works as neither role ids nor permissions contain commas.
+func setListExtension(ext map[string]interface{}, name string, values []string) {
+	if len(values) > 0 {
+		ext[name] = strings.Join(values, ",")
+	}
+}
+
+func QueueRoleUpdateEvent(ctx context.Context, da dao.DataAccessor, role *pb.Role, action pb.RoleUpdateEvent_Action, diff RoleDiff) error {
+	return QueueEvent(ctx, da, RoleUpdateEventType, role.Id, &pb.RoleUpdateEvent{
+		Role:   role,
+		Action: action,
+	}, diff.extensions())
+}
+
+func QueueUserPermUpdateEvent(ctx context.Context, da dao.DataAccessor, user *pb.User, action pb.UserPermissionUpdateEvent_Action, diff UserDiff) error {
+	return QueueEvent(ctx, da, UserPermissionUpdateEventType, user.AccountId, &pb.UserPermissionUpdateEvent{
 		User:   user,
 		Action: action,
-	})
+	}, diff.extensions())
+}
 
-	if err != nil {
-		log.Printf("Could not send cloudevent: %v", err)
-	}
+func sequenceEntity(etype string, subject string) string {
+	return etype + "/" + subject
+}
+
+// formatSequence pads the sequence number, so that sequences
+// can be compared lexicographically as the extension requires.
+func formatSequence(seq int64) string {
+	return fmt.Sprintf("%020d", seq)
 }
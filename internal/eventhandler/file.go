@@ -0,0 +1,50 @@
+package eventhandler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// FileSink appends every event as a JSON line to a file.
+type FileSink struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+// NewFileSink opens the file at path for appending.
+// If path is "-", the events are written to stdout.
+func NewFileSink(path string) (*FileSink, error) {
+	if path == "-" {
+		return &FileSink{w: os.Stdout}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{w: f}, nil
+}
+
+func (s *FileSink) Send(_ context.Context, event cloudevents.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileSink) Close(_ context.Context) error {
+	if s.w == os.Stdout {
+		return nil
+	}
+	return s.w.Close()
+}
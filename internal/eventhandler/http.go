@@ -0,0 +1,18 @@
+package eventhandler
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// NewHttpSink posts every event to target using
+// the binary mode of the CloudEvents HTTP binding.
+func NewHttpSink(target string) (Sink, error) {
+	c, err := cloudevents.NewClientHTTP(cloudevents.WithTarget(target))
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientSink{
+		client: c,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package eventhandler
+
+import (
+	"context"
+	"github.com/Shopify/sarama"
+	"github.com/cloudevents/sdk-go/protocol/kafka_sarama/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// PartitionKeyExtension is the CloudEvents extension
+// which is used as message key by the Kafka sink.
+const PartitionKeyExtension = "partitionkey"
+
+// NewKafkaSink sends the events to topic. Unless structured is
+// set, they are encoded in the binary mode of the Kafka binding.
+func NewKafkaSink(brokers []string, topic string, structured bool) (Sink, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Version = sarama.V2_0_0_0
+	saramaConfig.Producer.Return.Successes = true
+
+	// the client is kept to check the connection to the brokers
+	client, err := sarama.NewClient(brokers, saramaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := kafka_sarama.NewSenderFromClient(client, topic)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	c, err := cloudevents.NewClient(sender, cloudevents.WithTimeNow(), cloudevents.WithUUIDs())
+	if err != nil {
+		_ = sender.Close(context.Background())
+		_ = client.Close()
+		return nil, err
+	}
+
+	return &clientSink{
+		client: c,
+		closer: func(ctx context.Context) error {
+			err := sender.Close(ctx)
+			if cerr := client.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		},
+		// refreshing the metadata does not take a context and
+		// can block for as long as all the retries of sarama take
+		check: asyncCheck(func() error {
+			return client.RefreshMetadata(topic)
+		}),
+		prepare: func(ctx context.Context, event cloudevents.Event) context.Context {
+			if structured {
+				ctx = binding.WithForceStructured(ctx)
+			}
+			// Set the producer message key
+			return kafka_sarama.WithMessageKey(ctx, sarama.StringEncoder(partitionKey(event)))
+		},
+	}, nil
+}
+
+// asyncCheck runs check in the background, so that waiting for it ends
+// with ctx. A check still running from a previous call is waited for
+// instead of starting another one, so that they do not pile up.
+func asyncCheck(check func() error) func(ctx context.Context) error {
+	type call struct {
+		done chan struct{}
+		err  error
+	}
+
+	var mu sync.Mutex
+	var running *call
+	return func(ctx context.Context) error {
+		mu.Lock()
+		c := running
+		if c == nil {
+			c = &call{done: make(chan struct{})}
+			running = c
+			go func() {
+				c.err = check()
+				mu.Lock()
+				running = nil
+				mu.Unlock()
+				close(c.done)
+			}()
+		}
+		mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return c.err
+		}
+	}
+}
+
+// partitionKey returns the partitionkey extension of event
+// or, if it does not have one, the id of the event.
+func partitionKey(event cloudevents.Event) string {
+	if key, err := types.ToString(event.Extensions()[PartitionKeyExtension]); err == nil && len(key) > 0 {
+		return key
+	}
+	return event.ID()
+}
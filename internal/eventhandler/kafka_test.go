@@ -0,0 +1,38 @@
+package eventhandler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsyncCheckEndsWithContext(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	var calls int32
+	check := asyncCheck(func() error {
+		atomic.AddInt32(&calls, 1)
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if err := check(ctx); err != context.DeadlineExceeded {
+			t.Errorf("check returned %v, want %v", err, context.DeadlineExceeded)
+		}
+		cancel()
+	}
+
+	<-started
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("check ran %d times while it was blocked, want 1", n)
+	}
+
+	close(release)
+	if err := check(context.Background()); err != nil {
+		t.Errorf("check returned %v after the blocked check ended", err)
+	}
+}
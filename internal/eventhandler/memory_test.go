@@ -0,0 +1,33 @@
+package eventhandler
+
+import (
+	"context"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// MemorySink records every event it is sent in memory. It is only
+// meant for tests, as it keeps every event forever.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []cloudevents.Event
+}
+
+func (s *MemorySink) Send(_ context.Context, event cloudevents.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event.Clone())
+	return nil
+}
+
+func (s *MemorySink) Close(_ context.Context) error {
+	return nil
+}
+
+// Events returns the recorded events in the order they have been sent.
+func (s *MemorySink) Events() []cloudevents.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]cloudevents.Event(nil), s.events...)
+}
@@ -0,0 +1,26 @@
+package eventhandler
+
+import (
+	"context"
+	"github.com/cloudevents/sdk-go/protocol/nats/v2"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func NewNatsSink(url string, subject string) (Sink, error) {
+	sender, err := nats.NewSender(url, subject, nats.NatsOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := cloudevents.NewClient(sender, cloudevents.WithTimeNow(), cloudevents.WithUUIDs())
+	if err != nil {
+		_ = sender.Close(context.Background())
+		return nil, err
+	}
+
+	return &clientSink{
+		client: c,
+		closer: sender.Close,
+	}, nil
+}
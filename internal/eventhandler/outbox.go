@@ -0,0 +1,181 @@
+package eventhandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/logging"
+	"github.com/cownetwork/indigo/internal/metrics"
+	"github.com/cownetwork/indigo/internal/model"
+	"go.uber.org/zap"
+	"math"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// RunRelay publishes the events from the outbox of da every interval
+// until ctx is done. Events are marked as sent only after they have been
+// delivered, so every event is published at least once. Events which
+// could not be sent are dead-lettered, if a destination has been configured.
+// A batch of events is claimed for lease, after which another instance
+// takes it over if the events have not been sent yet.
+func RunRelay(ctx context.Context, da dao.DataAccessor, interval time.Duration, batchSize int, lease time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := FlushOutbox(ctx, da, batchSize, lease); err != nil {
+			logging.L().Error("Could not relay outbox events", zap.Error(err))
+		}
+	}
+}
+
+// FlushOutbox publishes the pending events from the outbox of da in
+// batches of batchSize, until none are left or one could not be sent.
+func FlushOutbox(ctx context.Context, da dao.DataAccessor, batchSize int, lease time.Duration) error {
+	for {
+		n, err := relayBatch(ctx, da, batchSize, lease)
+		if err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
+
+// claimBatch claims up to limit pending events in order for lease. The
+// transaction only lasts as long as the claim, so that neither the row
+// locks nor the connection are held while the events are sent. If the
+// oldest events are claimed by another instance, none are returned, so
+// that the events are never sent out of order.
+func claimBatch(ctx context.Context, da dao.DataAccessor, limit int, lease time.Duration) ([]*model.OutboxEvent, error) {
+	var claimed []*model.OutboxEvent
+	err := da.Tx(ctx, func(tx dao.DataAccessor) error {
+		events, err := tx.GetPendingOutboxEvents(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var ids []int64
+		for _, e := range events {
+			if e.ClaimedUntil != nil && e.ClaimedUntil.After(now) {
+				break
+			}
+			claimed = append(claimed, e)
+			ids = append(ids, e.Id)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.ClaimOutboxEvents(ctx, ids, now.Add(lease))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// relayBatch sends up to limit pending events in order and returns how
+// many of them have been handled. Without dead-letter destination it stops
+// at the first event which could not be sent, so that the order of the
+// events is preserved, and releases the claim of the remaining events.
+func relayBatch(ctx context.Context, da dao.DataAccessor, limit int, lease time.Duration) (int, error) {
+	events, err := claimBatch(ctx, da, limit, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, e := range events {
+		event := cloudevents.NewEvent()
+		if err := json.Unmarshal(e.Payload, &event); err != nil {
+			// this will never succeed, so don't block the outbox with it
+			logging.L().Error("Dropping malformed outbox event", zap.Int64("outbox_id", e.Id), zap.Error(err))
+		} else if err := SendEvent(ctx, event); err != nil {
+			if deadLetter == nil || ctx.Err() != nil {
+				releaseBatch(da, events[i:])
+				return i, err
+			}
+
+			// give up on this event, so that it does not block the following ones
+			if dlErr := sendDeadLetter(ctx, event, retryConfig.MaxAttempts, err); dlErr != nil {
+				releaseBatch(da, events[i:])
+				return i, fmt.Errorf("%v (dead-lettering failed: %v)", err, dlErr)
+			}
+			logging.L().Warn("Dead-lettered outbox event", zap.Int64("outbox_id", e.Id), zap.Error(err))
+			metrics.EventsDeadLettered.WithLabelValues(e.Type).Inc()
+
+			if err := da.MarkOutboxEventDead(ctx, e.Id, retryConfig.MaxAttempts, err.Error()); err != nil {
+				return i, err
+			}
+			continue
+		}
+
+		if err := da.MarkOutboxEventSent(ctx, e.Id); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// releaseBatch lets the next relay retry the events right away instead
+// of after the lease. It does not use the context of the relay, as the
+// events are typically released because it has been cancelled.
+func releaseBatch(da dao.DataAccessor, events []*model.OutboxEvent) {
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		ids[i] = e.Id
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := da.ReleaseOutboxEvents(ctx, ids); err != nil {
+		logging.L().Warn("Could not release outbox events", zap.Error(err))
+	}
+}
+
+// RunCleanup deletes the events which have been sent more than retention
+// ago from the outbox of da every interval, until ctx is done. They are
+// kept until then so that watchers can resume from them, and as long as
+// a webhook has not got them.
+func RunCleanup(ctx context.Context, da dao.DataAccessor, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := cleanupOutbox(ctx, da, retention); err != nil {
+			logging.L().Error("Could not clean up outbox events", zap.Error(err))
+		}
+	}
+}
+
+func cleanupOutbox(ctx context.Context, da dao.DataAccessor, retention time.Duration) error {
+	webhooks, err := da.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	maxPosition := int64(math.MaxInt64)
+	for _, webhook := range webhooks {
+		if webhook.Position < maxPosition {
+			maxPosition = webhook.Position
+		}
+	}
+
+	_, err = da.DeleteSentOutboxEvents(ctx, time.Now().Add(-retention), maxPosition)
+	return err
+}
@@ -0,0 +1,160 @@
+package eventhandler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Sink is a destination CloudEvents are published to.
+type Sink interface {
+	Send(ctx context.Context, event cloudevents.Event) error
+	Close(ctx context.Context) error
+}
+
+// Checker is implemented by sinks which can tell
+// whether they are currently able to send events.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Check checks s, if it is a Checker.
+func Check(ctx context.Context, s Sink) error {
+	if c, ok := s.(Checker); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+type SinkConfig struct {
+	KafkaBrokers    []string
+	KafkaTopic      string
+	KafkaStructured bool
+	NatsUrl         string
+	NatsSubject     string
+	HttpTarget      string
+	FilePath        string
+}
+
+// OpenSink opens the sinks with the given names, which are "kafka",
+// "nats", "http", "file" and "stdout". If more than one name
+// is given, the returned sink fans out every event to all of them.
+func OpenSink(names []string, c SinkConfig) (Sink, error) {
+	var sinks []Sink
+	for _, name := range names {
+		s, err := openSink(strings.TrimSpace(name), c)
+		if err != nil {
+			_ = FanOutSink(sinks).Close(context.Background())
+			return nil, fmt.Errorf("could not open %s sink: %v", name, err)
+		}
+		sinks = append(sinks, s)
+	}
+
+	switch len(sinks) {
+	case 0:
+		return nil, fmt.Errorf("no sink configured")
+	case 1:
+		return sinks[0], nil
+	}
+	return FanOutSink(sinks), nil
+}
+
+func openSink(name string, c SinkConfig) (Sink, error) {
+	switch name {
+	case "kafka":
+		return NewKafkaSink(c.KafkaBrokers, c.KafkaTopic, c.KafkaStructured)
+	case "nats":
+		return NewNatsSink(c.NatsUrl, c.NatsSubject)
+	case "http":
+		return NewHttpSink(c.HttpTarget)
+	case "file":
+		return NewFileSink(c.FilePath)
+	case "stdout":
+		return NewFileSink("-")
+	}
+	return nil, fmt.Errorf("unknown sink")
+}
+
+// FanOutSink sends every event to all of its sinks.
+type FanOutSink []Sink
+
+// FanOutError is returned by FanOutSink if some of its sinks failed.
+// Only the Failed ones have to be retried, as the others have the event.
+type FanOutError struct {
+	Failed FanOutSink
+	errs   []string
+	total  int
+}
+
+func (e *FanOutError) Error() string {
+	return fmt.Sprintf("failed to send to %d of %d sinks: %s", len(e.Failed), e.total, strings.Join(e.errs, "; "))
+}
+
+func (f FanOutSink) Send(ctx context.Context, event cloudevents.Event) error {
+	var failed FanOutSink
+	var errs []string
+	for _, s := range f {
+		if err := s.Send(ctx, event); err != nil {
+			failed = append(failed, s)
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return &FanOutError{Failed: failed, errs: errs, total: len(f)}
+	}
+	return nil
+}
+
+func (f FanOutSink) Check(ctx context.Context) error {
+	for _, s := range f {
+		if err := Check(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f FanOutSink) Close(ctx context.Context) error {
+	var err error
+	for _, s := range f {
+		if e := s.Close(ctx); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// clientSink sends events with a cloudevents.Client.
+type clientSink struct {
+	client cloudevents.Client
+	closer func(ctx context.Context) error
+	// prepare adds protocol specific options for event to ctx.
+	prepare func(ctx context.Context, event cloudevents.Event) context.Context
+	check   func(ctx context.Context) error
+}
+
+func (s *clientSink) Send(ctx context.Context, event cloudevents.Event) error {
+	if s.prepare != nil {
+		ctx = s.prepare(ctx, event)
+	}
+	if result := s.client.Send(ctx, event); !cloudevents.IsACK(result) {
+		return fmt.Errorf("failed to send: %v", result)
+	}
+	return nil
+}
+
+func (s *clientSink) Check(ctx context.Context) error {
+	if s.check == nil {
+		return nil
+	}
+	return s.check(ctx)
+}
+
+func (s *clientSink) Close(ctx context.Context) error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer(ctx)
+}
@@ -0,0 +1,48 @@
+package eventhandler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cownetwork/indigo/internal/backoff"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// flakySink fails the first failures events it is sent.
+type flakySink struct {
+	MemorySink
+	failures int
+}
+
+func (s *flakySink) Send(ctx context.Context, event cloudevents.Event) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	return s.MemorySink.Send(ctx, event)
+}
+
+func TestFanOutRetriesFailedSinks(t *testing.T) {
+	defer ConfigureRetries(retryConfig)
+	ConfigureRetries(backoff.Config{InitialInterval: time.Millisecond, MaxAttempts: 3})
+
+	healthy := &MemorySink{}
+	flaky := &flakySink{failures: 2}
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetType("test")
+	event.SetSource("test")
+
+	if err := sendWithRetries(context.Background(), FanOutSink{healthy, flaky}, event); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if n := len(healthy.Events()); n != 1 {
+		t.Errorf("healthy sink got the event %d times, want 1", n)
+	}
+	if n := len(flaky.Events()); n != 1 {
+		t.Errorf("flaky sink got the event %d times, want 1", n)
+	}
+}
@@ -0,0 +1,228 @@
+package eventhandler
+
+import (
+	"context"
+	"errors"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/logging"
+	"github.com/cownetwork/indigo/internal/model"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+const (
+	RoleSnapshotType      = "cow.indigo.v1.RoleSnapshot"
+	UserSnapshotType      = "cow.indigo.v1.UserSnapshot"
+	SnapshotCompletedType = "cow.indigo.v1.SnapshotCompleted"
+
+	snapshotIdExtension = "snapshotid"
+)
+
+// snapshotSink receives the snapshots. It is nil
+// if no snapshot destination has been configured.
+var snapshotSink Sink
+
+// SetSnapshotSink makes the snapshots be published to s, which
+// should be a compacted Kafka topic, as the snapshot events are
+// keyed by role id and account id.
+func SetSnapshotSink(s Sink) {
+	snapshotSink = s
+}
+
+// PublishSnapshot publishes a RoleSnapshot, carrying a Role, for every role
+// and, if includeUsers is set, a UserSnapshot, carrying a User with role ids,
+// for every user. All events of a snapshot share the snapshotid extension.
+// After all of them have been sent, a SnapshotCompleted event is published,
+// so that consumers can tell entries of older snapshots apart as deleted.
+// Deleted roles and users, which had update events, get a snapshot event
+// without data, which is a tombstone on a compacted topic in binary mode.
+// The snapshot events carry the sequence number of the last update event of
+// their entity, so that consumers know which update events to apply on top.
+// All entities are read from the same snapshot of the database.
+func PublishSnapshot(ctx context.Context, da dao.DataAccessor, includeUsers bool) (roles int, users int, err error) {
+	if snapshotSink == nil {
+		return 0, 0, errors.New("no snapshot sink configured")
+	}
+
+	snapshotId := uuid.New().String()
+
+	var events []cloudevents.Event
+	err = da.ReadTx(ctx, func(tx dao.DataAccessor) error {
+		sequences, err := tx.ListEventSequences(ctx)
+		if err != nil {
+			return err
+		}
+		seqs := map[string]int64{}
+		for _, s := range sequences {
+			seqs[s.Entity] = s.Sequence
+		}
+
+		events, roles, err = roleSnapshotEvents(ctx, tx, snapshotId, seqs)
+		if err != nil || !includeUsers {
+			return err
+		}
+
+		var userEvents []cloudevents.Event
+		userEvents, users, err = userSnapshotEvents(ctx, tx, snapshotId, seqs)
+		events = append(events, userEvents...)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, event := range events {
+		if err := sendWithRetries(ctx, snapshotSink, event); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	completed := cloudevents.NewEvent()
+	completed.SetID(uuid.New().String())
+	completed.SetTime(time.Now())
+	completed.SetSource(sourceUri)
+	completed.SetType(SnapshotCompletedType)
+	completed.SetExtension(snapshotIdExtension, snapshotId)
+	completed.SetExtension(PartitionKeyExtension, "snapshot")
+	completed.SetExtension("snapshotroles", roles)
+	completed.SetExtension("snapshotusers", users)
+
+	return roles, users, sendWithRetries(ctx, snapshotSink, completed)
+}
+
+// RunSnapshots publishes a snapshot right away and then
+// every interval until ctx is done.
+func RunSnapshots(ctx context.Context, da dao.DataAccessor, interval time.Duration, includeUsers bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		roles, users, err := PublishSnapshot(ctx, da, includeUsers)
+		if err != nil {
+			logging.L().Error("Could not publish snapshot", zap.Error(err))
+		} else {
+			logging.L().Info("Published snapshot", zap.Int("roles", roles), zap.Int("users", users))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func roleSnapshotEvents(ctx context.Context, da dao.DataAccessor, snapshotId string, seqs map[string]int64) ([]cloudevents.Event, int, error) {
+	roles, err := da.ListRoles(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	bindings, err := da.ListRolePermissionBindings(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	perms := map[string][]*model.RolePermissionBinding{}
+	for _, binding := range bindings {
+		perms[binding.RoleId] = append(perms[binding.RoleId], binding)
+	}
+
+	var events []cloudevents.Event
+	existing := map[string]bool{}
+	for _, role := range roles {
+		existing[role.Id] = true
+		role.SetPermissions(perms[role.Id])
+
+		event, err := NewEvent(RoleSnapshotType, role.ToProtoRole())
+		if err != nil {
+			return nil, 0, err
+		}
+		event.SetExtension(snapshotIdExtension, snapshotId)
+		event.SetSubject(role.Id)
+		event.SetExtension(PartitionKeyExtension, role.Id)
+		event.SetExtension(SequenceExtension, formatSequence(seqs[sequenceEntity(RoleUpdateEventType, role.Id)]))
+		events = append(events, event)
+	}
+	events = append(events, tombstones(RoleSnapshotType, RoleUpdateEventType, snapshotId, seqs, existing)...)
+	return events, len(roles), nil
+}
+
+func userSnapshotEvents(ctx context.Context, da dao.DataAccessor, snapshotId string, seqs map[string]int64) ([]cloudevents.Event, int, error) {
+	roleBindings, err := da.ListUserRoleBindings(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	permBindings, err := da.ListUserPermissionBindings(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var accountIds []string
+	users := map[string]*model.User{}
+	user := func(accountId string) *model.User {
+		u, ok := users[accountId]
+		if !ok {
+			u = model.NewUser(accountId)
+			users[accountId] = u
+			accountIds = append(accountIds, accountId)
+		}
+		return u
+	}
+	for _, binding := range roleBindings {
+		user(binding.UserAccountId).AddRoles([]string{binding.RoleId})
+	}
+	for _, binding := range permBindings {
+		user(binding.UserAccountId).AddPermissions([]string{binding.Permission})
+	}
+
+	var events []cloudevents.Event
+	existing := map[string]bool{}
+	for _, accountId := range accountIds {
+		existing[accountId] = true
+		event, err := NewEvent(UserSnapshotType, users[accountId].ToProtoUser())
+		if err != nil {
+			return nil, 0, err
+		}
+		event.SetExtension(snapshotIdExtension, snapshotId)
+		event.SetSubject(accountId)
+		event.SetExtension(PartitionKeyExtension, accountId)
+		event.SetExtension(SequenceExtension, formatSequence(seqs[sequenceEntity(UserPermissionUpdateEventType, accountId)]))
+		events = append(events, event)
+	}
+	events = append(events, tombstones(UserSnapshotType, UserPermissionUpdateEventType, snapshotId, seqs, existing)...)
+	return events, len(accountIds), nil
+}
+
+// tombstones returns a snapshot event of type snapshotType without data for
+// every entity which had events of type updateType but does not exist anymore.
+func tombstones(snapshotType string, updateType string, snapshotId string, seqs map[string]int64, existing map[string]bool) []cloudevents.Event {
+	prefix := sequenceEntity(updateType, "")
+
+	var events []cloudevents.Event
+	for entity, seq := range seqs {
+		if !strings.HasPrefix(entity, prefix) {
+			continue
+		}
+		id := entity[len(prefix):]
+		if existing[id] {
+			continue
+		}
+
+		event := cloudevents.NewEvent()
+		event.SetID(uuid.New().String())
+		event.SetTime(time.Now())
+		event.SetSource(sourceUri)
+		event.SetType(snapshotType)
+		event.SetExtension(snapshotIdExtension, snapshotId)
+		event.SetSubject(id)
+		event.SetExtension(PartitionKeyExtension, id)
+		event.SetExtension(SequenceExtension, formatSequence(seq))
+		events = append(events, event)
+	}
+	return events
+}
@@ -0,0 +1,69 @@
+package eventhandler
+
+import (
+	"context"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"github.com/cownetwork/indigo/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// TraceParentExtension is the extension of the CloudEvents distributed
+// tracing extension, which carries the W3C trace context of an event.
+const TraceParentExtension = "traceparent"
+
+// eventCarrier stores trace context in the extensions of a CloudEvent.
+type eventCarrier struct {
+	event *cloudevents.Event
+}
+
+func (c eventCarrier) Get(key string) string {
+	value, _ := types.ToString(c.event.Extensions()[key])
+	return value
+}
+
+func (c eventCarrier) Set(key string, value string) {
+	c.event.SetExtension(key, value)
+}
+
+func (c eventCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.event.Extensions()))
+	for key := range c.event.Extensions() {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// injectTraceContext adds the trace context of ctx to event, so that
+// consumers can continue the trace of the change the event describes.
+func injectTraceContext(ctx context.Context, event *cloudevents.Event) {
+	otel.GetTextMapPropagator().Inject(ctx, eventCarrier{event})
+}
+
+// startSendSpan starts the span of sending event. It continues the trace
+// of the event, if it carries one, or otherwise adds the new span to it.
+func startSendSpan(ctx context.Context, event *cloudevents.Event) (context.Context, trace.Span) {
+	propagator := otel.GetTextMapPropagator()
+	carrier := eventCarrier{event}
+	hasParent := len(carrier.Get(TraceParentExtension)) > 0
+	if hasParent {
+		ctx = propagator.Extract(ctx, carrier)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "send "+event.Type(), trace.WithSpanKind(trace.SpanKindProducer))
+	if !hasParent {
+		propagator.Inject(ctx, carrier)
+	}
+	return ctx, span
+}
+
+func endSendSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
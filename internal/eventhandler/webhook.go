@@ -0,0 +1,182 @@
+package eventhandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/cownetwork/indigo/internal/backoff"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/logging"
+	"github.com/cownetwork/indigo/internal/model"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader contains the hex encoded HMAC-SHA256 of the
+	// request body, keyed with the secret of the webhook.
+	SignatureHeader = "X-Indigo-Signature"
+
+	webhookBatchSize = 100
+)
+
+// RunWebhooks delivers the events which have been relayed from the
+// outbox of da to all registered webhooks every interval, until ctx is
+// done. Every webhook receives its events in order, a webhook which keeps
+// failing is retried on the next interval without holding up the others.
+func RunWebhooks(ctx context.Context, da dao.DataAccessor, interval time.Duration, timeout time.Duration) {
+	client := &http.Client{Timeout: timeout}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		webhooks, err := da.ListWebhooks(ctx)
+		if err != nil {
+			logging.L().Error("Could not list webhooks", zap.Error(err))
+			continue
+		}
+
+		// webhooks which are still being delivered to
+		// from the last interval are claimed already
+		for _, w := range webhooks {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				if err := deliverWebhook(ctx, da, client, id); err != nil {
+					logging.L().Warn("Could not deliver events to webhook", zap.String("webhook_id", id), zap.Error(err))
+				}
+			}(w.Id)
+		}
+	}
+}
+
+// webhookLease returns the time until which a webhook is claimed to deliver
+// the next event to it, which the retries of the event must not outlast.
+func webhookLease(client *http.Client) time.Time {
+	lease := 2 * time.Minute
+	if 2*client.Timeout > lease {
+		lease = 2 * client.Timeout
+	}
+	// postgres stores microseconds, the claim is compared with it
+	return time.Now().Add(lease).Truncate(time.Microsecond)
+}
+
+// deliverWebhook sends the events the webhook has not received yet and
+// records the outcome after every event. The webhook is claimed meanwhile,
+// so that other instances do not deliver the same events, and no database
+// transaction is held open while posting the events.
+func deliverWebhook(ctx context.Context, da dao.DataAccessor, client *http.Client, id string) error {
+	w, err := da.ClaimWebhook(ctx, id, webhookLease(client))
+	if err != nil || w == nil {
+		return err
+	}
+
+	// record stores the status of w and moves the claim to
+	// claimedUntil, failing if the claim has been lost.
+	record := func(claimedUntil *time.Time) error {
+		ok, err := da.UpdateWebhookStatus(ctx, w, claimedUntil)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("webhook has been claimed by another instance")
+		}
+		w.ClaimedUntil = claimedUntil
+		return nil
+	}
+
+	filter := model.OutboxFilter{Types: w.EventTypes}
+	for {
+		// the latest position is read before the events, so that the webhook
+		// moves past the events of other types and does not hold up the cleanup
+		latest, err := da.GetLatestOutboxPosition(ctx)
+		if err != nil {
+			_ = record(nil)
+			return err
+		}
+		events, err := da.GetOutboxEventsAfter(ctx, w.Position, filter, webhookBatchSize)
+		if err != nil {
+			_ = record(nil)
+			return err
+		}
+
+		for _, e := range events {
+			now := time.Now()
+			w.LastAttemptAt = &now
+
+			claimCtx, cancel := context.WithDeadline(ctx, *w.ClaimedUntil)
+			err := backoff.Retry(claimCtx, retryConfig, func(int) error {
+				return postWebhook(claimCtx, client, w, e.Payload)
+			})
+			cancel()
+			if err != nil {
+				w.LastError = err.Error()
+				w.Failures++
+				return record(nil)
+			}
+
+			w.Position = *e.Position
+			w.LastSuccessAt = &now
+			w.LastError = ""
+			w.Failures = 0
+			until := webhookLease(client)
+			if err := record(&until); err != nil {
+				return err
+			}
+		}
+		if len(events) < webhookBatchSize {
+			if latest > w.Position {
+				w.Position = latest
+			}
+			break
+		}
+	}
+	return record(nil)
+}
+
+// postWebhook posts payload, which is a CloudEvent in its JSON format,
+// to the webhook using the structured mode of the CloudEvents HTTP binding.
+func postWebhook(ctx context.Context, client *http.Client, w *model.Webhook, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=UTF-8")
+	req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, payload))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// Sign computes the signature of body which is sent in the SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,157 @@
+// Package health checks the dependencies of indigo periodically and
+// reports the result through the gRPC health service and over HTTP.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check returns an error if a dependency is not available.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Monitor runs its checks and sets the serving status of the
+// gRPC health server, for the server as a whole and for each of
+// the services, to SERVING only if all of them passed.
+type Monitor struct {
+	server   *grpchealth.Server
+	services []string
+	checks   []namedCheck
+
+	mu       sync.RWMutex
+	results  map[string]error
+	checked  bool
+	shutdown bool
+}
+
+func NewMonitor(server *grpchealth.Server, services ...string) *Monitor {
+	m := &Monitor{
+		server:   server,
+		services: services,
+		results:  map[string]error{},
+	}
+	m.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return m
+}
+
+// Add adds a check. It must not be called once the Monitor runs.
+func (m *Monitor) Add(name string, check Check) {
+	m.checks = append(m.checks, namedCheck{name: name, check: check})
+}
+
+// Run runs all checks every interval, with at most timeout each, until ctx is done.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.runChecks(ctx, timeout)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) runChecks(ctx context.Context, timeout time.Duration) {
+	results := map[string]error{}
+	for _, c := range m.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		results[c.name] = c.check(checkCtx)
+		cancel()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results = results
+	m.checked = true
+	if m.shutdown {
+		return
+	}
+	if m.ready() {
+		m.setStatus(healthpb.HealthCheckResponse_SERVING)
+	} else {
+		m.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// Shutdown reports the server as not serving from now on,
+// so that no new requests are sent to it while it shuts down.
+func (m *Monitor) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shutdown = true
+	m.server.Shutdown()
+}
+
+// ready has to be called with m.mu held.
+func (m *Monitor) ready() bool {
+	if !m.checked || m.shutdown {
+		return false
+	}
+	for _, err := range m.results {
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Monitor) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	m.server.SetServingStatus("", status)
+	for _, service := range m.services {
+		m.server.SetServingStatus(service, status)
+	}
+}
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Handler serves /healthz, which succeeds as long as the process
+// is running, and /readyz, which succeeds only if all checks
+// passed and describes the result of every check.
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.RLock()
+		res := readiness{Status: "ready", Checks: map[string]string{}}
+		for name, err := range m.results {
+			res.Checks[name] = "ok"
+			if err != nil {
+				res.Checks[name] = err.Error()
+			}
+		}
+		code := http.StatusOK
+		if !m.ready() {
+			res.Status = "not ready"
+			if m.shutdown {
+				res.Status = "shutting down"
+			}
+			code = http.StatusServiceUnavailable
+		}
+		m.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	return mux
+}
@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/auth"
+	"github.com/cownetwork/indigo/internal/reqmeta"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// UnaryServerInterceptor attaches a logger with the request id, the method
+// and the account and role ids of the request to the context of every
+// request, and logs the result of the request. It has to run after the
+// interceptors of reqmeta and auth.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		fields := append(requestFields(ctx, info.FullMethod), messageFields(req)...)
+		ctx = NewContext(ctx, fields...)
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logResult(ctx, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor does the same as UnaryServerInterceptor for streams.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := NewContext(ss.Context(), requestFields(ss.Context(), info.FullMethod)...)
+
+		start := time.Now()
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		logResult(ctx, start, err)
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func requestFields(ctx context.Context, method string) []zap.Field {
+	meta := reqmeta.FromContext(ctx)
+	fields := []zap.Field{
+		zap.String("request_id", meta.RequestId),
+		zap.String("method", method),
+	}
+	if len(meta.Actor) > 0 {
+		fields = append(fields, zap.String("actor", meta.Actor))
+	}
+	if id, ok := auth.FromContext(ctx); ok {
+		fields = append(fields, zap.String("caller", id.Name))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		fields = append(fields, zap.String("trace_id", span.TraceID().String()))
+	}
+	return fields
+}
+
+// messageFields returns the account and role ids the request refers to.
+func messageFields(req interface{}) []zap.Field {
+	var fields []zap.Field
+	if r, ok := req.(interface{ GetUserAccountId() string }); ok && len(r.GetUserAccountId()) > 0 {
+		fields = append(fields, zap.String("account_id", r.GetUserAccountId()))
+	}
+	if r, ok := req.(interface{ GetRoleId() *pb.RoleIdentifier }); ok && r.GetRoleId() != nil {
+		fields = append(fields, zap.String("role_id", roleId(r.GetRoleId())))
+	}
+	if r, ok := req.(interface{ GetRoleIds() []*pb.RoleIdentifier }); ok && len(r.GetRoleIds()) > 0 {
+		var ids []string
+		for _, id := range r.GetRoleIds() {
+			ids = append(ids, roleId(id))
+		}
+		fields = append(fields, zap.Strings("role_ids", ids))
+	}
+	return fields
+}
+
+// roleId returns the uuid of the role or its type and name.
+func roleId(id *pb.RoleIdentifier) string {
+	if name := id.GetNameId(); name != nil {
+		return name.GetType() + ":" + name.GetName()
+	}
+	return id.GetUuid()
+}
+
+func logResult(ctx context.Context, start time.Time, err error) {
+	code := status.Code(err)
+	lvl := zapcore.InfoLevel
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.DeadlineExceeded:
+		lvl = zapcore.ErrorLevel
+	}
+
+	l := FromContext(ctx)
+	if ce := l.Check(lvl, "Handled request"); ce != nil {
+		fields := []zap.Field{
+			zap.String("code", code.String()),
+			zap.Duration("duration", time.Since(start)),
+		}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		}
+		ce.Write(fields...)
+	}
+}
@@ -0,0 +1,94 @@
+// Package logging provides the structured, leveled logger of indigo.
+// The level can be changed while the service is running.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"os"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+var (
+	level  = zap.NewAtomicLevel()
+	logger = newLogger(zapcore.NewJSONEncoder(encoderConfig()))
+)
+
+// Setup replaces the global logger by one writing in the given
+// format to stderr and sets the level, e.g. debug, info or warn.
+func Setup(format string, lvl string) error {
+	if err := SetLevel(lvl); err != nil {
+		return err
+	}
+
+	var enc zapcore.Encoder
+	switch format {
+	case FormatJSON:
+		enc = zapcore.NewJSONEncoder(encoderConfig())
+	case FormatText:
+		cfg := encoderConfig()
+		cfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		enc = zapcore.NewConsoleEncoder(cfg)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	logger = newLogger(enc)
+	return nil
+}
+
+func encoderConfig() zapcore.EncoderConfig {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	return cfg
+}
+
+func newLogger(enc zapcore.Encoder) *zap.Logger {
+	return zap.New(zapcore.NewCore(enc, zapcore.Lock(os.Stderr), level), zap.AddCaller())
+}
+
+// SetLevel changes the level of the global logger and of all loggers derived from it.
+func SetLevel(lvl string) error {
+	if err := level.UnmarshalText([]byte(lvl)); err != nil {
+		return fmt.Errorf("invalid log level %q", lvl)
+	}
+	return nil
+}
+
+// LevelHandler returns the current level on GET and changes
+// it on PUT, both as JSON like {"level":"debug"}.
+func LevelHandler() http.Handler {
+	return level
+}
+
+// L returns the global logger.
+func L() *zap.Logger {
+	return logger
+}
+
+// Sync flushes buffered log entries.
+func Sync() {
+	_ = logger.Sync()
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx, whose FromContext logs with the given fields.
+func NewContext(ctx context.Context, fields ...zap.Field) context.Context {
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(fields...))
+}
+
+// FromContext returns the logger of the request ctx belongs
+// to, or the global logger if there is none.
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return logger
+}
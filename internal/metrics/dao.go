@@ -0,0 +1,277 @@
+package metrics
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/model"
+	"github.com/cownetwork/indigo/internal/tracing"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"time"
+)
+
+// DataAccessor decorates another dao.DataAccessor and records the
+// duration of every call per method, as metric and as span.
+type DataAccessor struct {
+	dao.DataAccessor
+}
+
+func NewDataAccessor(da dao.DataAccessor) *DataAccessor {
+	return &DataAccessor{DataAccessor: da}
+}
+
+// Tx records the duration of the whole transaction, as well as
+// of the calls done on the DataAccessor passed to fn.
+func (d *DataAccessor) Tx(ctx context.Context, fn func(tx dao.DataAccessor) error) error {
+	ctx, end := observeQuery(ctx, "Tx")
+	defer end()
+	return d.DataAccessor.Tx(ctx, func(tx dao.DataAccessor) error {
+		return fn(NewDataAccessor(tx))
+	})
+}
+
+func (d *DataAccessor) ReadTx(ctx context.Context, fn func(tx dao.DataAccessor) error) error {
+	ctx, end := observeQuery(ctx, "ReadTx")
+	defer end()
+	return d.DataAccessor.ReadTx(ctx, func(tx dao.DataAccessor) error {
+		return fn(NewDataAccessor(tx))
+	})
+}
+
+// observeQuery starts a span for a call of method. The returned
+// function ends it and records the duration of the call.
+func observeQuery(ctx context.Context, method string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "dao."+method)
+	return ctx, func() {
+		span.End()
+		QueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (d *DataAccessor) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	ctx, end := observeQuery(ctx, "ListRoles")
+	defer end()
+	return d.DataAccessor.ListRoles(ctx)
+}
+
+func (d *DataAccessor) InsertRole(ctx context.Context, role *model.Role) error {
+	ctx, end := observeQuery(ctx, "InsertRole")
+	defer end()
+	return d.DataAccessor.InsertRole(ctx, role)
+}
+
+func (d *DataAccessor) UpdateRole(ctx context.Context, roleId *pb.RoleIdentifier, role *model.Role) error {
+	ctx, end := observeQuery(ctx, "UpdateRole")
+	defer end()
+	return d.DataAccessor.UpdateRole(ctx, roleId, role)
+}
+
+func (d *DataAccessor) GetRole(ctx context.Context, roleId *pb.RoleIdentifier) (*model.Role, error) {
+	ctx, end := observeQuery(ctx, "GetRole")
+	defer end()
+	return d.DataAccessor.GetRole(ctx, roleId)
+}
+
+func (d *DataAccessor) DeleteRole(ctx context.Context, roleId string) error {
+	ctx, end := observeQuery(ctx, "DeleteRole")
+	defer end()
+	return d.DataAccessor.DeleteRole(ctx, roleId)
+}
+
+func (d *DataAccessor) GetRolePermissions(ctx context.Context, roleId string) ([]*model.RolePermissionBinding, error) {
+	ctx, end := observeQuery(ctx, "GetRolePermissions")
+	defer end()
+	return d.DataAccessor.GetRolePermissions(ctx, roleId)
+}
+
+func (d *DataAccessor) AddRolePermissions(ctx context.Context, roleId string, permissions []string) ([]string, error) {
+	ctx, end := observeQuery(ctx, "AddRolePermissions")
+	defer end()
+	return d.DataAccessor.AddRolePermissions(ctx, roleId, permissions)
+}
+
+func (d *DataAccessor) RemoveRolePermissions(ctx context.Context, roleId string, permissions []string) ([]string, error) {
+	ctx, end := observeQuery(ctx, "RemoveRolePermissions")
+	defer end()
+	return d.DataAccessor.RemoveRolePermissions(ctx, roleId, permissions)
+}
+
+func (d *DataAccessor) GetUserRoleBindings(ctx context.Context, userAccountId string) ([]*model.UserRoleBinding, error) {
+	ctx, end := observeQuery(ctx, "GetUserRoleBindings")
+	defer end()
+	return d.DataAccessor.GetUserRoleBindings(ctx, userAccountId)
+}
+
+func (d *DataAccessor) GetRoleUserBindings(ctx context.Context, roleId string) ([]*model.UserRoleBinding, error) {
+	ctx, end := observeQuery(ctx, "GetRoleUserBindings")
+	defer end()
+	return d.DataAccessor.GetRoleUserBindings(ctx, roleId)
+}
+
+func (d *DataAccessor) AddUserRoles(ctx context.Context, userAccountId string, roleIds []string) ([]string, error) {
+	ctx, end := observeQuery(ctx, "AddUserRoles")
+	defer end()
+	return d.DataAccessor.AddUserRoles(ctx, userAccountId, roleIds)
+}
+
+func (d *DataAccessor) RemoveUserRoles(ctx context.Context, userAccountId string, roleIds []string) ([]string, error) {
+	ctx, end := observeQuery(ctx, "RemoveUserRoles")
+	defer end()
+	return d.DataAccessor.RemoveUserRoles(ctx, userAccountId, roleIds)
+}
+
+func (d *DataAccessor) GetUserPermissions(ctx context.Context, userAccountId string) ([]*model.UserPermissionBinding, error) {
+	ctx, end := observeQuery(ctx, "GetUserPermissions")
+	defer end()
+	return d.DataAccessor.GetUserPermissions(ctx, userAccountId)
+}
+
+func (d *DataAccessor) AddUserPermissions(ctx context.Context, userAccountId string, permissions []string) ([]string, error) {
+	ctx, end := observeQuery(ctx, "AddUserPermissions")
+	defer end()
+	return d.DataAccessor.AddUserPermissions(ctx, userAccountId, permissions)
+}
+
+func (d *DataAccessor) RemoveUserPermissions(ctx context.Context, userAccountId string, permissions []string) ([]string, error) {
+	ctx, end := observeQuery(ctx, "RemoveUserPermissions")
+	defer end()
+	return d.DataAccessor.RemoveUserPermissions(ctx, userAccountId, permissions)
+}
+
+func (d *DataAccessor) ListRolePermissionBindings(ctx context.Context) ([]*model.RolePermissionBinding, error) {
+	ctx, end := observeQuery(ctx, "ListRolePermissionBindings")
+	defer end()
+	return d.DataAccessor.ListRolePermissionBindings(ctx)
+}
+
+func (d *DataAccessor) ListUserRoleBindings(ctx context.Context) ([]*model.UserRoleBinding, error) {
+	ctx, end := observeQuery(ctx, "ListUserRoleBindings")
+	defer end()
+	return d.DataAccessor.ListUserRoleBindings(ctx)
+}
+
+func (d *DataAccessor) ListUserPermissionBindings(ctx context.Context) ([]*model.UserPermissionBinding, error) {
+	ctx, end := observeQuery(ctx, "ListUserPermissionBindings")
+	defer end()
+	return d.DataAccessor.ListUserPermissionBindings(ctx)
+}
+
+func (d *DataAccessor) CountEntities(ctx context.Context) (*model.EntityCounts, error) {
+	ctx, end := observeQuery(ctx, "CountEntities")
+	defer end()
+	return d.DataAccessor.CountEntities(ctx)
+}
+
+func (d *DataAccessor) InsertOutboxEvent(ctx context.Context, event *model.OutboxEvent) error {
+	ctx, end := observeQuery(ctx, "InsertOutboxEvent")
+	defer end()
+	return d.DataAccessor.InsertOutboxEvent(ctx, event)
+}
+
+func (d *DataAccessor) NextEventSequence(ctx context.Context, entity string) (int64, error) {
+	ctx, end := observeQuery(ctx, "NextEventSequence")
+	defer end()
+	return d.DataAccessor.NextEventSequence(ctx, entity)
+}
+
+func (d *DataAccessor) ListEventSequences(ctx context.Context) ([]*model.EventSequence, error) {
+	ctx, end := observeQuery(ctx, "ListEventSequences")
+	defer end()
+	return d.DataAccessor.ListEventSequences(ctx)
+}
+
+func (d *DataAccessor) GetPendingOutboxEvents(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	ctx, end := observeQuery(ctx, "GetPendingOutboxEvents")
+	defer end()
+	return d.DataAccessor.GetPendingOutboxEvents(ctx, limit)
+}
+
+func (d *DataAccessor) ClaimOutboxEvents(ctx context.Context, ids []int64, until time.Time) error {
+	ctx, end := observeQuery(ctx, "ClaimOutboxEvents")
+	defer end()
+	return d.DataAccessor.ClaimOutboxEvents(ctx, ids, until)
+}
+
+func (d *DataAccessor) ReleaseOutboxEvents(ctx context.Context, ids []int64) error {
+	ctx, end := observeQuery(ctx, "ReleaseOutboxEvents")
+	defer end()
+	return d.DataAccessor.ReleaseOutboxEvents(ctx, ids)
+}
+
+func (d *DataAccessor) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	ctx, end := observeQuery(ctx, "MarkOutboxEventSent")
+	defer end()
+	return d.DataAccessor.MarkOutboxEventSent(ctx, id)
+}
+
+func (d *DataAccessor) MarkOutboxEventDead(ctx context.Context, id int64, attempts int, reason string) error {
+	ctx, end := observeQuery(ctx, "MarkOutboxEventDead")
+	defer end()
+	return d.DataAccessor.MarkOutboxEventDead(ctx, id, attempts, reason)
+}
+
+func (d *DataAccessor) GetDeadOutboxEvents(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	ctx, end := observeQuery(ctx, "GetDeadOutboxEvents")
+	defer end()
+	return d.DataAccessor.GetDeadOutboxEvents(ctx, limit)
+}
+
+func (d *DataAccessor) RedriveOutboxEvents(ctx context.Context, ids []int64) (int64, error) {
+	ctx, end := observeQuery(ctx, "RedriveOutboxEvents")
+	defer end()
+	return d.DataAccessor.RedriveOutboxEvents(ctx, ids)
+}
+
+func (d *DataAccessor) GetOutboxEventsAfter(ctx context.Context, position int64, filter model.OutboxFilter, limit int) ([]*model.OutboxEvent, error) {
+	ctx, end := observeQuery(ctx, "GetOutboxEventsAfter")
+	defer end()
+	return d.DataAccessor.GetOutboxEventsAfter(ctx, position, filter, limit)
+}
+
+func (d *DataAccessor) GetLatestOutboxPosition(ctx context.Context) (int64, error) {
+	ctx, end := observeQuery(ctx, "GetLatestOutboxPosition")
+	defer end()
+	return d.DataAccessor.GetLatestOutboxPosition(ctx)
+}
+
+func (d *DataAccessor) GetOutboxHorizon(ctx context.Context) (int64, error) {
+	ctx, end := observeQuery(ctx, "GetOutboxHorizon")
+	defer end()
+	return d.DataAccessor.GetOutboxHorizon(ctx)
+}
+
+func (d *DataAccessor) DeleteSentOutboxEvents(ctx context.Context, before time.Time, maxPosition int64) (int64, error) {
+	ctx, end := observeQuery(ctx, "DeleteSentOutboxEvents")
+	defer end()
+	return d.DataAccessor.DeleteSentOutboxEvents(ctx, before, maxPosition)
+}
+
+func (d *DataAccessor) InsertWebhook(ctx context.Context, webhook *model.Webhook) error {
+	ctx, end := observeQuery(ctx, "InsertWebhook")
+	defer end()
+	return d.DataAccessor.InsertWebhook(ctx, webhook)
+}
+
+func (d *DataAccessor) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	ctx, end := observeQuery(ctx, "ListWebhooks")
+	defer end()
+	return d.DataAccessor.ListWebhooks(ctx)
+}
+
+func (d *DataAccessor) ClaimWebhook(ctx context.Context, id string, until time.Time) (*model.Webhook, error) {
+	ctx, end := observeQuery(ctx, "ClaimWebhook")
+	defer end()
+	return d.DataAccessor.ClaimWebhook(ctx, id, until)
+}
+
+func (d *DataAccessor) UpdateWebhookStatus(ctx context.Context, webhook *model.Webhook, claimedUntil *time.Time) (bool, error) {
+	ctx, end := observeQuery(ctx, "UpdateWebhookStatus")
+	defer end()
+	return d.DataAccessor.UpdateWebhookStatus(ctx, webhook, claimedUntil)
+}
+
+func (d *DataAccessor) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	ctx, end := observeQuery(ctx, "DeleteWebhook")
+	defer end()
+	return d.DataAccessor.DeleteWebhook(ctx, id)
+}
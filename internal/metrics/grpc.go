@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// UnaryServerInterceptor records the duration and status code of every request.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+		observeRequest(info.FullMethod, start, err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor records the duration and status code of every stream.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		observeRequest(info.FullMethod, start, err)
+		return err
+	}
+}
+
+func observeRequest(method string, start time.Time, err error) {
+	RequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	RequestsTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+}
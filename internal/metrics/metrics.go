@@ -0,0 +1,98 @@
+// Package metrics contains the Prometheus metrics of indigo.
+package metrics
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"time"
+)
+
+const namespace = "indigo"
+
+var (
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "Number of handled gRPC requests by method and status code.",
+	}, []string{"method", "code"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Duration of gRPC requests by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dao_query_duration_seconds",
+		Help:      "Duration of data access calls by method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	EventsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_sent_total",
+		Help:      "Number of events sent by type and result, which is success or failure after all retries.",
+	}, []string{"type", "result"})
+
+	EventSendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "event_send_duration_seconds",
+		Help:      "Duration of sending an event, including retries, by type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+
+	EventsDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dead_lettered_total",
+		Help:      "Number of events that have been dead-lettered by type.",
+	}, []string{"type"})
+
+	PermissionChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "permission_checks_total",
+		Help:      "Number of permission checks by result, which is allow or deny.",
+	}, []string{"result"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Number of requests rejected by the rate limits by method and limit, which is rate or concurrency.",
+	}, []string{"method", "limit"})
+
+	Entities = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "entities",
+		Help:      "Number of roles and bindings by kind.",
+	}, []string{"kind"})
+)
+
+// RunEntityGauges updates the Entities gauge with
+// the counts from da every interval, until ctx is done.
+func RunEntityGauges(ctx context.Context, da dao.DataAccessor, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		counts, err := da.CountEntities(ctx)
+		if err != nil {
+			logging.L().Error("Could not count entities", zap.Error(err))
+		} else {
+			Entities.WithLabelValues("roles").Set(float64(counts.Roles))
+			Entities.WithLabelValues("role_permissions").Set(float64(counts.RolePermissions))
+			Entities.WithLabelValues("user_roles").Set(float64(counts.UserRoles))
+			Entities.WithLabelValues("user_permissions").Set(float64(counts.UserPermissions))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// OutboxEvent is a CloudEvent which has been written together with
+// the data change it describes, to be published by the relay.
+type OutboxEvent struct {
+	Id        int64      `db:"id,omitempty"`
+	Type      string     `db:"type"`
+	Subject   string     `db:"subject"`
+	Payload   []byte     `db:"payload"`
+	CreatedAt time.Time  `db:"created_at,omitempty"`
+	SentAt    *time.Time `db:"sent_at,omitempty"`
+	// Attempts and LastError describe why an event
+	// has been dead-lettered at DeadAt.
+	Attempts  int        `db:"attempts,omitempty"`
+	LastError string     `db:"last_error,omitempty"`
+	DeadAt    *time.Time `db:"dead_at,omitempty"`
+	// Position is assigned once the event has been relayed. It
+	// reflects the order in which the events have been relayed.
+	Position *int64 `db:"position,omitempty"`
+	// ClaimedUntil is the time until which a relay is sending the event.
+	ClaimedUntil *time.Time `db:"claimed_until,omitempty"`
+}
+
+// OutboxFilter selects outbox events by their subject and type.
+// Empty fields match every event.
+type OutboxFilter struct {
+	Subjects []string
+	Types    []string
+}
+
+// EventSequence is the sequence number of the
+// last event that has been queued for an entity.
+type EventSequence struct {
+	Entity   string `db:"entity"`
+	Sequence int64  `db:"sequence"`
+}
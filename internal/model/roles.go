@@ -101,3 +101,11 @@ func ToRoleNameIdentifier(name string, t string) *pb.RoleIdentifier {
 		}},
 	}
 }
+
+// EntityCounts contains the number of roles and bindings.
+type EntityCounts struct {
+	Roles           uint64
+	RolePermissions uint64
+	UserRoles       uint64
+	UserPermissions uint64
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"github.com/upper/db/v4/adapter/postgresql"
+	"time"
+)
+
+// Webhook is an HTTP endpoint the events are delivered to. Position
+// is the position of the last outbox event that has been delivered.
+type Webhook struct {
+	Id         string                 `db:"id"`
+	Url        string                 `db:"url"`
+	EventTypes postgresql.StringArray `db:"event_types"`
+	Secret     string                 `db:"secret"`
+	Position   int64                  `db:"position"`
+	CreatedAt  time.Time              `db:"created_at,omitempty"`
+	// LastAttemptAt, LastSuccessAt, LastError and Failures describe
+	// the delivery status, Failures being the failed attempts in a row.
+	LastAttemptAt *time.Time `db:"last_attempt_at,omitempty"`
+	LastSuccessAt *time.Time `db:"last_success_at,omitempty"`
+	LastError     string     `db:"last_error"`
+	Failures      int        `db:"failures"`
+	// ClaimedUntil is the time until which an instance delivers to the webhook.
+	ClaimedUntil *time.Time `db:"claimed_until,omitempty"`
+}
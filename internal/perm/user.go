@@ -0,0 +1,25 @@
+package perm
+
+import (
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"sort"
+)
+
+// NewUserValidator creates a validator for the permissions of user. The
+// permissions of roles with a higher priority override the ones of
+// lower roles, the custom permissions of the user override all roles.
+func NewUserValidator(user *pb.User) *Validator {
+	roles := append([]*pb.Role(nil), user.Roles...)
+	sort.SliceStable(roles, func(i, j int) bool {
+		return roles[i].Priority < roles[j].Priority
+	})
+
+	var prevPrio int32
+	v := NewValidator([]string{})
+	for _, role := range roles {
+		v.Append(role.Permissions, prevPrio < role.Priority)
+		prevPrio = role.Priority
+	}
+	v.Append(user.CustomPermissions, true)
+	return v
+}
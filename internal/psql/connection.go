@@ -0,0 +1,86 @@
+package psql
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/backoff"
+	"github.com/cownetwork/indigo/internal/logging"
+	"github.com/upper/db/v4"
+	"github.com/upper/db/v4/adapter/postgresql"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// StatementTimeout aborts every statement running longer
+	// than this on the server side. Zero disables it.
+	StatementTimeout time.Duration
+}
+
+// Open connects to the database, retrying with the given backoff
+// until the database is reachable or ctx is done.
+func Open(ctx context.Context, connUrl *postgresql.ConnectionURL, pool PoolConfig, bc backoff.Config) (db.Session, error) {
+	if pool.StatementTimeout > 0 {
+		if connUrl.Options == nil {
+			connUrl.Options = map[string]string{}
+		}
+		connUrl.Options["statement_timeout"] = strconv.FormatInt(pool.StatementTimeout.Milliseconds(), 10)
+	}
+
+	var sess db.Session
+	err := backoff.Retry(ctx, bc, func(attempt int) error {
+		s, err := postgresql.Open(connUrl)
+		if err != nil {
+			logging.L().Warn("Could not connect to postgres", zap.Int("attempt", attempt), zap.Error(err))
+			return err
+		}
+		sess = s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sess.SetMaxOpenConns(pool.MaxOpenConns)
+	sess.SetMaxIdleConns(pool.MaxIdleConns)
+	sess.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	return sess, nil
+}
+
+// KeepAlive pings the database every interval until ctx is done.
+// When the database went away it keeps pinging with backoff until it
+// is back and resets the session, so that statements cached for the
+// old connections are dropped.
+func KeepAlive(ctx context.Context, sess db.Session, interval time.Duration, bc backoff.Config) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := sess.Ping(); err == nil {
+			continue
+		}
+
+		logging.L().Warn("Lost connection to postgres, reconnecting ...")
+		err := backoff.Retry(ctx, bc, func(attempt int) error {
+			err := sess.Ping()
+			if err != nil {
+				logging.L().Warn("Could not reconnect to postgres", zap.Int("attempt", attempt), zap.Error(err))
+			}
+			return err
+		})
+		if err != nil {
+			return
+		}
+		sess.Reset()
+		logging.L().Info("Reconnected to PostgresSQL.")
+	}
+}
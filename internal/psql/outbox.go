@@ -0,0 +1,173 @@
+package psql
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/model"
+	"github.com/upper/db/v4"
+	"time"
+)
+
+// nextOutboxPosition assigns the next position to an event that has
+// been relayed, keeping it if the event has been relayed before.
+var nextOutboxPosition = db.Raw("coalesce(position, nextval('event_outbox_position_seq'))")
+
+func (d *DataAccessor) InsertOutboxEvent(ctx context.Context, event *model.OutboxEvent) error {
+	coll := d.collection(ctx, "event_outbox")
+	return coll.InsertReturning(event)
+}
+
+func (d *DataAccessor) GetPendingOutboxEvents(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	q := d.Session.WithContext(ctx).SQL().
+		SelectFrom("event_outbox").
+		Where("sent_at IS NULL AND dead_at IS NULL").
+		OrderBy("id").
+		Limit(limit).
+		Amend(func(query string) string {
+			// other instances wait until we relayed these events,
+			// so that the events are never sent out of order
+			return query + " FOR UPDATE"
+		})
+
+	var events []*model.OutboxEvent
+	err := q.All(&events)
+	return events, err
+}
+
+func (d *DataAccessor) ClaimOutboxEvents(ctx context.Context, ids []int64, until time.Time) error {
+	coll := d.collection(ctx, "event_outbox")
+	return coll.Find(db.Cond{"id IN": ids}).Update(map[string]interface{}{
+		"claimed_until": until,
+	})
+}
+
+func (d *DataAccessor) ReleaseOutboxEvents(ctx context.Context, ids []int64) error {
+	coll := d.collection(ctx, "event_outbox")
+	return coll.Find(db.Cond{"id IN": ids, "sent_at IS": nil, "dead_at IS": nil}).Update(map[string]interface{}{
+		"claimed_until": nil,
+	})
+}
+
+func (d *DataAccessor) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	coll := d.collection(ctx, "event_outbox")
+	return coll.Find("id", id).Update(map[string]interface{}{
+		"sent_at":  time.Now(),
+		"position": nextOutboxPosition,
+	})
+}
+
+func (d *DataAccessor) MarkOutboxEventDead(ctx context.Context, id int64, attempts int, reason string) error {
+	coll := d.collection(ctx, "event_outbox")
+	return coll.Find("id", id).Update(map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": reason,
+		"dead_at":    time.Now(),
+	})
+}
+
+func (d *DataAccessor) GetDeadOutboxEvents(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	coll := d.collection(ctx, "event_outbox")
+	res := coll.Find(db.Cond{"dead_at IS NOT": nil}).OrderBy("id").Limit(limit)
+
+	var events []*model.OutboxEvent
+	err := res.All(&events)
+	return events, err
+}
+
+func (d *DataAccessor) RedriveOutboxEvents(ctx context.Context, ids []int64) (int64, error) {
+	cond := db.Cond{"dead_at IS NOT": nil}
+	if len(ids) > 0 {
+		cond["id IN"] = ids
+	}
+
+	q := d.Session.WithContext(ctx).SQL().
+		Update("event_outbox").
+		Set(map[string]interface{}{
+			"dead_at":    nil,
+			"attempts":   0,
+			"last_error": "",
+		}).
+		Where(cond)
+
+	res, err := q.Exec()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (d *DataAccessor) NextEventSequence(ctx context.Context, entity string) (int64, error) {
+	row, err := d.Session.WithContext(ctx).SQL().QueryRow(`
+		INSERT INTO event_sequences (entity, sequence) VALUES (?, 1)
+		ON CONFLICT (entity) DO UPDATE SET sequence = event_sequences.sequence + 1
+		RETURNING sequence`, entity)
+	if err != nil {
+		return 0, err
+	}
+
+	var seq int64
+	err = row.Scan(&seq)
+	return seq, err
+}
+
+func (d *DataAccessor) ListEventSequences(ctx context.Context) ([]*model.EventSequence, error) {
+	coll := d.collection(ctx, "event_sequences")
+
+	var sequences []*model.EventSequence
+	err := coll.Find().All(&sequences)
+	return sequences, err
+}
+
+func (d *DataAccessor) GetOutboxEventsAfter(ctx context.Context, position int64, filter model.OutboxFilter, limit int) ([]*model.OutboxEvent, error) {
+	// dead events have not been delivered, they get
+	// a position once they have been re-driven and sent
+	cond := db.Cond{"position >": position, "dead_at IS": nil}
+	if len(filter.Subjects) > 0 {
+		cond["subject IN"] = filter.Subjects
+	}
+	if len(filter.Types) > 0 {
+		cond["type IN"] = filter.Types
+	}
+
+	coll := d.collection(ctx, "event_outbox")
+	res := coll.Find(cond).OrderBy("position").Limit(limit)
+
+	var events []*model.OutboxEvent
+	err := res.All(&events)
+	return events, err
+}
+
+func (d *DataAccessor) GetLatestOutboxPosition(ctx context.Context) (int64, error) {
+	// the horizon is the latest position if all events have been deleted
+	return d.queryPosition(ctx, `SELECT greatest((SELECT max(position) FROM event_outbox), position) FROM event_outbox_horizon`)
+}
+
+func (d *DataAccessor) GetOutboxHorizon(ctx context.Context) (int64, error) {
+	return d.queryPosition(ctx, `SELECT position FROM event_outbox_horizon`)
+}
+
+func (d *DataAccessor) queryPosition(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	row, err := d.Session.WithContext(ctx).SQL().QueryRow(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var position int64
+	err = row.Scan(&position)
+	return position, err
+}
+
+func (d *DataAccessor) DeleteSentOutboxEvents(ctx context.Context, before time.Time, maxPosition int64) (int64, error) {
+	row, err := d.Session.WithContext(ctx).SQL().QueryRow(`
+		WITH deleted AS (
+			DELETE FROM event_outbox WHERE sent_at < ? AND position <= ? RETURNING position
+		)
+		UPDATE event_outbox_horizon SET position = greatest(position, (SELECT max(position) FROM deleted))
+		RETURNING (SELECT count(*) FROM deleted)`, before, maxPosition)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err = row.Scan(&n)
+	return n, err
+}
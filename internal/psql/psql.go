@@ -1,7 +1,10 @@
 package psql
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"github.com/cownetwork/indigo/internal/dao"
 	"github.com/cownetwork/indigo/internal/model"
 	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
 	"github.com/upper/db/v4"
@@ -11,8 +14,14 @@ type DataAccessor struct {
 	Session db.Session
 }
 
-func (d *DataAccessor) ListRoles() ([]*model.Role, error) {
-	coll := d.Session.Collection("role_definitions")
+// collection returns the named collection bound to ctx, so that
+// the queries run on it are cancelled together with the context.
+func (d *DataAccessor) collection(ctx context.Context, name string) db.Collection {
+	return d.Session.WithContext(ctx).Collection(name)
+}
+
+func (d *DataAccessor) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	coll := d.collection(ctx, "role_definitions")
 	res := coll.Find()
 
 	var roles []*model.Role
@@ -20,8 +29,8 @@ func (d *DataAccessor) ListRoles() ([]*model.Role, error) {
 	return roles, err
 }
 
-func (d *DataAccessor) InsertRole(role *model.Role) error {
-	coll := d.Session.Collection("role_definitions")
+func (d *DataAccessor) InsertRole(ctx context.Context, role *model.Role) error {
+	coll := d.collection(ctx, "role_definitions")
 
 	_, err := coll.Insert(role)
 	if err != nil {
@@ -30,8 +39,8 @@ func (d *DataAccessor) InsertRole(role *model.Role) error {
 	return nil
 }
 
-func (d *DataAccessor) UpdateRole(roleId *pb.RoleIdentifier, role *model.Role) error {
-	coll := d.Session.Collection("role_definitions")
+func (d *DataAccessor) UpdateRole(ctx context.Context, roleId *pb.RoleIdentifier, role *model.Role) error {
+	coll := d.collection(ctx, "role_definitions")
 
 	switch u := roleId.Id.(type) {
 	case *pb.RoleIdentifier_Uuid:
@@ -44,8 +53,8 @@ func (d *DataAccessor) UpdateRole(roleId *pb.RoleIdentifier, role *model.Role) e
 	return coll.UpdateReturning(role)
 }
 
-func (d *DataAccessor) GetRole(roleId *pb.RoleIdentifier) (*model.Role, error) {
-	coll := d.Session.Collection("role_definitions")
+func (d *DataAccessor) GetRole(ctx context.Context, roleId *pb.RoleIdentifier) (*model.Role, error) {
+	coll := d.collection(ctx, "role_definitions")
 
 	var res db.Result
 	switch u := roleId.Id.(type) {
@@ -72,20 +81,20 @@ func (d *DataAccessor) GetRole(roleId *pb.RoleIdentifier) (*model.Role, error) {
 	return &role, err
 }
 
-func (d *DataAccessor) DeleteRole(roleId string) error {
-	coll := d.Session.Collection("user_roles")
+func (d *DataAccessor) DeleteRole(ctx context.Context, roleId string) error {
+	coll := d.collection(ctx, "user_roles")
 	err := coll.Find("role_id", roleId).Delete()
 	if err != nil {
 		return err
 	}
 
-	coll = d.Session.Collection("role_permissions")
+	coll = d.collection(ctx, "role_permissions")
 	err = coll.Find("role_id", roleId).Delete()
 	if err != nil {
 		return err
 	}
 
-	coll = d.Session.Collection("role_definitions")
+	coll = d.collection(ctx, "role_definitions")
 	err = coll.Find("id", roleId).Delete()
 	if err != nil {
 		return err
@@ -94,8 +103,8 @@ func (d *DataAccessor) DeleteRole(roleId string) error {
 	return nil
 }
 
-func (d *DataAccessor) GetRolePermissions(roleId string) ([]*model.RolePermissionBinding, error) {
-	res := d.Session.Collection("role_permissions").Find("role_id", roleId)
+func (d *DataAccessor) GetRolePermissions(ctx context.Context, roleId string) ([]*model.RolePermissionBinding, error) {
+	res := d.collection(ctx, "role_permissions").Find("role_id", roleId)
 	var bindings []*model.RolePermissionBinding
 
 	err := res.All(&bindings)
@@ -103,8 +112,8 @@ func (d *DataAccessor) GetRolePermissions(roleId string) ([]*model.RolePermissio
 	return bindings, err
 }
 
-func (d *DataAccessor) AddRolePermissions(roleId string, permissions []string) ([]string, error) {
-	coll := d.Session.Collection("role_permissions")
+func (d *DataAccessor) AddRolePermissions(ctx context.Context, roleId string, permissions []string) ([]string, error) {
+	coll := d.collection(ctx, "role_permissions")
 
 	var addedPerms []string
 	for _, perm := range permissions {
@@ -126,8 +135,8 @@ func (d *DataAccessor) AddRolePermissions(roleId string, permissions []string) (
 	return addedPerms, nil
 }
 
-func (d *DataAccessor) RemoveRolePermissions(roleId string, permissions []string) ([]string, error) {
-	coll := d.Session.Collection("role_permissions")
+func (d *DataAccessor) RemoveRolePermissions(ctx context.Context, roleId string, permissions []string) ([]string, error) {
+	coll := d.collection(ctx, "role_permissions")
 
 	var removedPerms []string
 	for _, perm := range permissions {
@@ -144,8 +153,8 @@ func (d *DataAccessor) RemoveRolePermissions(roleId string, permissions []string
 	return removedPerms, nil
 }
 
-func (d *DataAccessor) GetUserRoleBindings(userAccountId string) ([]*model.UserRoleBinding, error) {
-	coll := d.Session.Collection("user_roles")
+func (d *DataAccessor) GetUserRoleBindings(ctx context.Context, userAccountId string) ([]*model.UserRoleBinding, error) {
+	coll := d.collection(ctx, "user_roles")
 	res := coll.Find("user_account_id", userAccountId)
 
 	var roleBindings []*model.UserRoleBinding
@@ -154,8 +163,18 @@ func (d *DataAccessor) GetUserRoleBindings(userAccountId string) ([]*model.UserR
 	return roleBindings, err
 }
 
-func (d *DataAccessor) AddUserRoles(userAccountId string, roleIds []string) ([]string, error) {
-	coll := d.Session.Collection("user_roles")
+func (d *DataAccessor) GetRoleUserBindings(ctx context.Context, roleId string) ([]*model.UserRoleBinding, error) {
+	coll := d.collection(ctx, "user_roles")
+	res := coll.Find("role_id", roleId)
+
+	var roleBindings []*model.UserRoleBinding
+	err := res.All(&roleBindings)
+
+	return roleBindings, err
+}
+
+func (d *DataAccessor) AddUserRoles(ctx context.Context, userAccountId string, roleIds []string) ([]string, error) {
+	coll := d.collection(ctx, "user_roles")
 
 	var addedRoles []string
 	for _, id := range roleIds {
@@ -178,8 +197,8 @@ func (d *DataAccessor) AddUserRoles(userAccountId string, roleIds []string) ([]s
 	return addedRoles, nil
 }
 
-func (d *DataAccessor) RemoveUserRoles(userAccountId string, roleIds []string) ([]string, error) {
-	coll := d.Session.Collection("user_roles")
+func (d *DataAccessor) RemoveUserRoles(ctx context.Context, userAccountId string, roleIds []string) ([]string, error) {
+	coll := d.collection(ctx, "user_roles")
 
 	var removedRoles []string
 	for _, id := range roleIds {
@@ -196,8 +215,8 @@ func (d *DataAccessor) RemoveUserRoles(userAccountId string, roleIds []string) (
 	return removedRoles, nil
 }
 
-func (d *DataAccessor) GetUserPermissions(userAccountId string) ([]*model.UserPermissionBinding, error) {
-	coll := d.Session.Collection("user_permissions")
+func (d *DataAccessor) GetUserPermissions(ctx context.Context, userAccountId string) ([]*model.UserPermissionBinding, error) {
+	coll := d.collection(ctx, "user_permissions")
 
 	res := coll.Find("user_account_id", userAccountId)
 
@@ -207,8 +226,8 @@ func (d *DataAccessor) GetUserPermissions(userAccountId string) ([]*model.UserPe
 	return permBindings, err
 }
 
-func (d *DataAccessor) AddUserPermissions(userAccountId string, permissions []string) ([]string, error) {
-	coll := d.Session.Collection("user_permissions")
+func (d *DataAccessor) AddUserPermissions(ctx context.Context, userAccountId string, permissions []string) ([]string, error) {
+	coll := d.collection(ctx, "user_permissions")
 
 	var addedPerms []string
 	for _, permission := range permissions {
@@ -230,13 +249,13 @@ func (d *DataAccessor) AddUserPermissions(userAccountId string, permissions []st
 	return addedPerms, nil
 }
 
-func (d *DataAccessor) RemoveUserPermissions(userAccountId string, permissions []string) ([]string, error) {
-	coll := d.Session.Collection("user_permissions")
+func (d *DataAccessor) RemoveUserPermissions(ctx context.Context, userAccountId string, permissions []string) ([]string, error) {
+	coll := d.collection(ctx, "user_permissions")
 
 	var removedPerms []string
 	for _, permission := range permissions {
 		exists, _ := coll.Find("user_account_id", userAccountId).And("permission", permission).Exists()
-		if exists {
+		if !exists {
 			continue
 		}
 
@@ -247,3 +266,16 @@ func (d *DataAccessor) RemoveUserPermissions(userAccountId string, permissions [
 	}
 	return removedPerms, nil
 }
+
+func (d *DataAccessor) Tx(ctx context.Context, fn func(tx dao.DataAccessor) error) error {
+	return d.Session.TxContext(ctx, func(sess db.Session) error {
+		return fn(&DataAccessor{Session: sess})
+	}, nil)
+}
+
+func (d *DataAccessor) ReadTx(ctx context.Context, fn func(tx dao.DataAccessor) error) error {
+	opts := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	return d.Session.TxContext(ctx, func(sess db.Session) error {
+		return fn(&DataAccessor{Session: sess})
+	}, opts)
+}
@@ -0,0 +1,106 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/upper/db/v4"
+	"github.com/upper/db/v4/adapter/postgresql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAccountId = "8f5b2c0e-0c3a-4d8e-9a59-1d6f8e0f2a11"
+
+// openTestSession connects to the database INDIGO_TEST_POSTGRES_URL points
+// to and migrates a schema of its own, which is dropped after the test.
+func openTestSession(t *testing.T) db.Session {
+	url := os.Getenv("INDIGO_TEST_POSTGRES_URL")
+	if len(url) == 0 {
+		t.Skip("INDIGO_TEST_POSTGRES_URL is not set")
+	}
+	connUrl, err := postgresql.ParseURL(url)
+	if err != nil {
+		t.Fatalf("could not parse INDIGO_TEST_POSTGRES_URL: %v", err)
+	}
+
+	sess, err := postgresql.Open(connUrl)
+	if err != nil {
+		t.Fatalf("could not connect to postgres: %v", err)
+	}
+	schema := "indigo_test_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if _, err := sess.Driver().(*sql.DB).Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("could not create schema: %v", err)
+	}
+	_ = sess.Close()
+
+	connUrl.Options["search_path"] = schema
+	sess, err = postgresql.Open(connUrl)
+	if err != nil {
+		t.Fatalf("could not connect to postgres: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = sess.Driver().(*sql.DB).Exec("DROP SCHEMA " + schema + " CASCADE")
+		_ = sess.Close()
+	})
+
+	migrate(t, sess.Driver().(*sql.DB))
+	return sess
+}
+
+// migrate runs the up migrations of db/migrations in order.
+func migrate(t *testing.T, conn *sql.DB) {
+	files, err := filepath.Glob("../../db/migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("could not find migrations: %v", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("could not read migration: %v", err)
+		}
+		up := strings.ReplaceAll(string(b), "\r", "")
+		up = strings.SplitN(up, "-- migrate:down", 2)[0]
+		for _, stmt := range strings.Split(up, ";") {
+			if len(strings.TrimSpace(strings.ReplaceAll(stmt, "-- migrate:up", ""))) == 0 {
+				continue
+			}
+			if _, err := conn.Exec(stmt); err != nil {
+				t.Fatalf("could not run migration %s: %v", filepath.Base(file), err)
+			}
+		}
+	}
+}
+
+func TestRemoveUserPermissions(t *testing.T) {
+	ctx := context.Background()
+	d := &DataAccessor{Session: openTestSession(t)}
+
+	if _, err := d.AddUserPermissions(ctx, testAccountId, []string{"cow.game.start", "cow.game.stop"}); err != nil {
+		t.Fatalf("AddUserPermissions failed: %v", err)
+	}
+
+	removed, err := d.RemoveUserPermissions(ctx, testAccountId, []string{"cow.game.start", "cow.chat"})
+	if err != nil {
+		t.Fatalf("RemoveUserPermissions failed: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"cow.game.start"}) {
+		t.Errorf("removed %v, want only the permission the account had", removed)
+	}
+
+	bindings, err := d.GetUserPermissions(ctx, testAccountId)
+	if err != nil {
+		t.Fatalf("GetUserPermissions failed: %v", err)
+	}
+	if len(bindings) != 1 || bindings[0].Permission != "cow.game.stop" {
+		t.Errorf("account has the permissions %v, want only cow.game.stop", bindings)
+	}
+}
@@ -0,0 +1,47 @@
+package psql
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/model"
+)
+
+func (d *DataAccessor) ListRolePermissionBindings(ctx context.Context) ([]*model.RolePermissionBinding, error) {
+	res := d.collection(ctx, "role_permissions").Find().OrderBy("role_id")
+
+	var bindings []*model.RolePermissionBinding
+	err := res.All(&bindings)
+	return bindings, err
+}
+
+func (d *DataAccessor) ListUserRoleBindings(ctx context.Context) ([]*model.UserRoleBinding, error) {
+	res := d.collection(ctx, "user_roles").Find().OrderBy("user_account_id")
+
+	var bindings []*model.UserRoleBinding
+	err := res.All(&bindings)
+	return bindings, err
+}
+
+func (d *DataAccessor) ListUserPermissionBindings(ctx context.Context) ([]*model.UserPermissionBinding, error) {
+	res := d.collection(ctx, "user_permissions").Find().OrderBy("user_account_id")
+
+	var bindings []*model.UserPermissionBinding
+	err := res.All(&bindings)
+	return bindings, err
+}
+
+func (d *DataAccessor) CountEntities(ctx context.Context) (*model.EntityCounts, error) {
+	counts := &model.EntityCounts{}
+	for table, count := range map[string]*uint64{
+		"role_definitions": &counts.Roles,
+		"role_permissions": &counts.RolePermissions,
+		"user_roles":       &counts.UserRoles,
+		"user_permissions": &counts.UserPermissions,
+	} {
+		n, err := d.collection(ctx, table).Find().Count()
+		if err != nil {
+			return nil, err
+		}
+		*count = n
+	}
+	return counts, nil
+}
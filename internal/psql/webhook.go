@@ -0,0 +1,77 @@
+package psql
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/model"
+	"github.com/upper/db/v4"
+	"time"
+)
+
+func (d *DataAccessor) InsertWebhook(ctx context.Context, webhook *model.Webhook) error {
+	coll := d.collection(ctx, "webhooks")
+	return coll.InsertReturning(webhook)
+}
+
+func (d *DataAccessor) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	res := d.collection(ctx, "webhooks").Find().OrderBy("created_at")
+
+	var webhooks []*model.Webhook
+	err := res.All(&webhooks)
+	return webhooks, err
+}
+
+func (d *DataAccessor) ClaimWebhook(ctx context.Context, id string, until time.Time) (*model.Webhook, error) {
+	sess := d.Session.WithContext(ctx).SQL()
+	rows, err := sess.QueryContext(ctx, `
+		UPDATE webhooks SET claimed_until = ?
+		WHERE id = ? AND (claimed_until IS NULL OR claimed_until < now())
+		RETURNING *`, until, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook model.Webhook
+	err = sess.NewIteratorContext(ctx, rows).One(&webhook)
+	if err == db.ErrNoMoreRows {
+		// another instance is delivering to this webhook already
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (d *DataAccessor) UpdateWebhookStatus(ctx context.Context, webhook *model.Webhook, claimedUntil *time.Time) (bool, error) {
+	q := d.Session.WithContext(ctx).SQL().
+		Update("webhooks").
+		Set(map[string]interface{}{
+			"position":        webhook.Position,
+			"last_attempt_at": webhook.LastAttemptAt,
+			"last_success_at": webhook.LastSuccessAt,
+			"last_error":      webhook.LastError,
+			"failures":        webhook.Failures,
+			"claimed_until":   claimedUntil,
+		}).
+		Where("id = ? AND claimed_until = ?", webhook.Id, webhook.ClaimedUntil)
+
+	res, err := q.Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (d *DataAccessor) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	q := d.Session.WithContext(ctx).SQL().
+		DeleteFrom("webhooks").
+		Where("id", id)
+
+	res, err := q.Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,223 @@
+// Package ratelimit limits the rate and the concurrency of the requests
+// of every caller, so that a single misbehaving caller cannot starve the
+// others.
+package ratelimit
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/auth"
+	"github.com/cownetwork/indigo/internal/metrics"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const RetryAfterHeader = "retry-after"
+
+// readPrefixes are the prefixes of the names of the methods
+// which only read and are limited by the read budget.
+var readPrefixes = []string{"Get", "List", "Has", "Watch"}
+
+type Config struct {
+	// ReadRate and WriteRate are the requests per second a caller can
+	// make on average, ReadBurst and WriteBurst how many at once.
+	// A rate of 0 disables the limit.
+	ReadRate   float64
+	ReadBurst  int
+	WriteRate  float64
+	WriteBurst int
+	// MaxConcurrent is the number of requests of a caller
+	// which can run at the same time. 0 disables the limit.
+	MaxConcurrent int
+}
+
+// Limiter keeps token buckets for every caller, which is identified by
+// its authenticated identity or otherwise by the address of its peer.
+type Limiter struct {
+	config Config
+
+	mu      sync.Mutex
+	callers map[string]*caller
+}
+
+type caller struct {
+	read     *rate.Limiter
+	write    *rate.Limiter
+	running  int
+	lastSeen time.Time
+}
+
+func New(c Config) *Limiter {
+	return &Limiter{config: c, callers: map[string]*caller{}}
+}
+
+// Run forgets the callers which did not make a request for
+// longer than idle, every interval until ctx is done.
+func (l *Limiter) Run(ctx context.Context, interval time.Duration, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		l.mu.Lock()
+		for key, c := range l.callers {
+			if c.running == 0 && time.Since(c.lastSeen) > idle {
+				delete(l.callers, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// acquire returns an error, and the delay after which the caller should
+// retry if it is known, if the caller of ctx exceeded its limits. Otherwise
+// a unary request counts as running until release is called. Streams are
+// not counted, as they keep running while the caller is idle.
+func (l *Limiter) acquire(ctx context.Context, method string, stream bool) (release func(), retryAfter time.Duration, err error) {
+	key := callerKey(ctx)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.callers[key]
+	if !ok {
+		c = &caller{
+			read:  newBucket(l.config.ReadRate, l.config.ReadBurst),
+			write: newBucket(l.config.WriteRate, l.config.WriteBurst),
+		}
+		l.callers[key] = c
+	}
+	c.lastSeen = now
+
+	if !stream && l.config.MaxConcurrent > 0 && c.running >= l.config.MaxConcurrent {
+		metrics.RateLimited.WithLabelValues(method, "concurrency").Inc()
+		return nil, 0, status.Errorf(codes.ResourceExhausted, "too many concurrent requests, at most %d are allowed", l.config.MaxConcurrent)
+	}
+
+	bucket := c.write
+	if isRead(method) {
+		bucket = c.read
+	}
+	r := bucket.ReserveN(now, 1)
+	if !r.OK() {
+		metrics.RateLimited.WithLabelValues(method, "rate").Inc()
+		return nil, 0, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		metrics.RateLimited.WithLabelValues(method, "rate").Inc()
+		return nil, delay, rateLimitExceeded(delay)
+	}
+
+	if stream {
+		return func() {}, 0, nil
+	}
+	c.running++
+	return func() {
+		l.mu.Lock()
+		c.running--
+		l.mu.Unlock()
+	}, 0, nil
+}
+
+func newBucket(r float64, burst int) *rate.Limiter {
+	if r <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(r), burst)
+}
+
+// rateLimitExceeded returns the error of a request which exceeded the
+// rate limit, with the delay as RetryInfo for clients that understand it.
+func rateLimitExceeded(delay time.Duration) error {
+	st := status.Newf(codes.ResourceExhausted, "rate limit exceeded, retry after %v", delay.Round(time.Millisecond))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// retryAfterTrailer returns the retry-after trailer, in whole seconds.
+func retryAfterTrailer(delay time.Duration) metadata.MD {
+	seconds := int(math.Ceil(delay.Seconds()))
+	return metadata.Pairs(RetryAfterHeader, strconv.Itoa(seconds))
+}
+
+func isRead(method string) bool {
+	name := method[strings.LastIndexByte(method, '/')+1:]
+	for _, prefix := range readPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func callerKey(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok {
+		return "identity:" + id.Name
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		return "peer:" + addr
+	}
+	return ""
+}
+
+// UnaryServerInterceptor rejects requests of callers which exceeded their
+// limits with ResourceExhausted. It has to run after the interceptor of auth.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if auth.Exempt(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		release, retryAfter, err := l.acquire(ctx, info.FullMethod, false)
+		if err != nil {
+			if retryAfter > 0 {
+				_ = grpc.SetTrailer(ctx, retryAfterTrailer(retryAfter))
+			}
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor does the same as UnaryServerInterceptor
+// for streams, except for the limit of concurrent requests.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if auth.Exempt(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		release, retryAfter, err := l.acquire(ss.Context(), info.FullMethod, true)
+		if err != nil {
+			if retryAfter > 0 {
+				ss.SetTrailer(retryAfterTrailer(retryAfter))
+			}
+			return err
+		}
+		defer release()
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/auth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+	"time"
+)
+
+const service = "/cow.indigo.v1.IndigoService/"
+
+// transportStream records the trailer set by unary interceptors.
+type transportStream struct {
+	grpc.ServerTransportStream
+	trailer metadata.MD
+}
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+// serverStream records the trailer set by stream interceptors.
+type serverStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	trailer metadata.MD
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func callerContext(name string) context.Context {
+	return auth.NewContext(context.Background(), &auth.Identity{Name: name})
+}
+
+// call calls the method through the unary interceptor of l.
+func call(l *Limiter, ctx context.Context, method string) (metadata.MD, error) {
+	stream := &transportStream{}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	_, err := l.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: service + method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	return stream.trailer, err
+}
+
+func TestReadAndWriteBucketsAreSeparate(t *testing.T) {
+	l := New(Config{ReadRate: 0.1, ReadBurst: 2, WriteRate: 0.1, WriteBurst: 1})
+	ctx := callerContext("lobby")
+
+	tests := []struct {
+		method string
+		code   codes.Code
+	}{
+		{"GetRole", codes.OK},
+		{"HasPermission", codes.OK},
+		{"ListRoles", codes.ResourceExhausted},
+		{"InsertRole", codes.OK},
+		{"AddUserRoles", codes.ResourceExhausted},
+	}
+	for _, test := range tests {
+		if _, err := call(l, ctx, test.method); status.Code(err) != test.code {
+			t.Errorf("%s returned %v, want %v", test.method, err, test.code)
+		}
+	}
+
+	// other callers have buckets of their own
+	if _, err := call(l, callerContext("game"), "InsertRole"); err != nil {
+		t.Errorf("InsertRole of another caller failed: %v", err)
+	}
+}
+
+func TestCallersWithoutIdentityAreLimitedByAddress(t *testing.T) {
+	l := New(Config{WriteRate: 0.1, WriteBurst: 1})
+	withPeer := func(addr string) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 1234}})
+	}
+
+	if _, err := call(l, withPeer("10.0.0.1"), "InsertRole"); err != nil {
+		t.Fatalf("InsertRole failed: %v", err)
+	}
+	if _, err := call(l, withPeer("10.0.0.1"), "InsertRole"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("InsertRole from the same address returned %v, want %v", err, codes.ResourceExhausted)
+	}
+	if _, err := call(l, withPeer("10.0.0.2"), "InsertRole"); err != nil {
+		t.Errorf("InsertRole from another address failed: %v", err)
+	}
+}
+
+// checkRetryAfter checks that err and the trailer carry the delay
+// after which the bucket with the rate of 0.5 has a token again.
+func checkRetryAfter(t *testing.T, trailer metadata.MD, err error) {
+	t.Helper()
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second request returned %v, want %v", err, codes.ResourceExhausted)
+	}
+	if v := trailer.Get(RetryAfterHeader); len(v) != 1 || v[0] != "2" {
+		t.Errorf("retry-after trailer is %v, want 2", v)
+	}
+
+	var info *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if d, ok := detail.(*errdetails.RetryInfo); ok {
+			info = d
+		}
+	}
+	if info == nil {
+		t.Fatalf("error has no RetryInfo: %v", err)
+	}
+	if delay := info.RetryDelay.AsDuration(); delay <= time.Second || delay > 2*time.Second {
+		t.Errorf("retry delay is %v, want between 1s and 2s", delay)
+	}
+}
+
+func TestUnaryRetryAfter(t *testing.T) {
+	l := New(Config{WriteRate: 0.5, WriteBurst: 1})
+	ctx := callerContext("lobby")
+
+	if _, err := call(l, ctx, "InsertRole"); err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	trailer, err := call(l, ctx, "InsertRole")
+	checkRetryAfter(t, trailer, err)
+}
+
+func TestStreamRetryAfter(t *testing.T) {
+	l := New(Config{ReadRate: 0.5, ReadBurst: 1})
+	watch := func() (metadata.MD, error) {
+		stream := &serverStream{ctx: callerContext("lobby")}
+		err := l.StreamServerInterceptor()(nil, stream, &grpc.StreamServerInfo{FullMethod: "/cow.indigo.v1.IndigoWatchService/Watch"},
+			func(srv interface{}, stream grpc.ServerStream) error {
+				return nil
+			})
+		return stream.trailer, err
+	}
+
+	if _, err := watch(); err != nil {
+		t.Fatalf("first stream failed: %v", err)
+	}
+	trailer, err := watch()
+	checkRetryAfter(t, trailer, err)
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	l := New(Config{MaxConcurrent: 1})
+	ctx := callerContext("lobby")
+
+	var inner error
+	_, err := l.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: service + "GetRole"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, inner = call(l, ctx, "GetRole")
+			return nil, nil
+		})
+	if err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	if status.Code(inner) != codes.ResourceExhausted {
+		t.Errorf("concurrent request returned %v, want %v", inner, codes.ResourceExhausted)
+	}
+	if _, err := call(l, ctx, "GetRole"); err != nil {
+		t.Errorf("request after the first one finished failed: %v", err)
+	}
+}
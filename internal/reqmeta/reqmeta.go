@@ -0,0 +1,83 @@
+package reqmeta
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	RequestIdHeader = "x-request-id"
+	ActorHeader     = "x-actor"
+)
+
+// Meta describes who made a request and how it can be correlated.
+type Meta struct {
+	RequestId string
+	Actor     string
+}
+
+type metaKey struct{}
+
+func NewContext(ctx context.Context, m *Meta) context.Context {
+	return context.WithValue(ctx, metaKey{}, m)
+}
+
+// FromContext returns the Meta of the request ctx belongs
+// to, or an empty one if there is none.
+func FromContext(ctx context.Context) *Meta {
+	if m, ok := ctx.Value(metaKey{}).(*Meta); ok {
+		return m
+	}
+	return &Meta{}
+}
+
+// FromIncomingContext reads the Meta from the gRPC metadata of ctx.
+// A request id is generated if the caller did not send one.
+func FromIncomingContext(ctx context.Context) *Meta {
+	m := &Meta{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		m.RequestId = first(md.Get(RequestIdHeader))
+		m.Actor = first(md.Get(ActorHeader))
+	}
+	if len(m.RequestId) == 0 {
+		m.RequestId = uuid.New().String()
+	}
+	return m
+}
+
+// UnaryServerInterceptor attaches the Meta of every request to its
+// context and returns the request id to the caller as header.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		m := FromIncomingContext(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIdHeader, m.RequestId))
+		return handler(NewContext(ctx, m), req)
+	}
+}
+
+// StreamServerInterceptor does the same as UnaryServerInterceptor for streams.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		m := FromIncomingContext(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(RequestIdHeader, m.RequestId))
+		return handler(srv, &serverStream{ServerStream: ss, ctx: NewContext(ss.Context(), m)})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
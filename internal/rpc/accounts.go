@@ -0,0 +1,107 @@
+package rpc
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/eventhandler"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AccountHandler implements eventhandler.AccountHandler by
+// removing or moving the role and permission bindings of accounts.
+type AccountHandler struct {
+	Dao dao.DataAccessor
+}
+
+func (h AccountHandler) DeleteAccount(ctx context.Context, accountId string) error {
+	return h.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		_, err := removeAccountBindings(ctx, tx, accountId)
+		return err
+	})
+}
+
+func (h AccountHandler) MergeAccount(ctx context.Context, accountId string, targetAccountId string) error {
+	if accountId == targetAccountId {
+		return nil
+	}
+
+	return h.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		diff, err := removeAccountBindings(ctx, tx, accountId)
+		if err != nil {
+			return err
+		}
+
+		addedRoles, err := tx.AddUserRoles(ctx, targetAccountId, diff.RemovedRoles)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not add user roles: %v", err)
+		}
+		if len(addedRoles) > 0 {
+			err := queueUserPermUpdateEvent(ctx, tx, targetAccountId, pb.UserPermissionUpdateEvent_ACTION_ROLE_ADDED,
+				eventhandler.UserDiff{AddedRoles: addedRoles})
+			if err != nil {
+				return err
+			}
+		}
+
+		addedPerms, err := tx.AddUserPermissions(ctx, targetAccountId, diff.RemovedPermissions)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not add user permissions: %v", err)
+		}
+		if len(addedPerms) > 0 {
+			return queueUserPermUpdateEvent(ctx, tx, targetAccountId, pb.UserPermissionUpdateEvent_ACTION_PERM_ADDED,
+				eventhandler.UserDiff{AddedPermissions: addedPerms})
+		}
+		return nil
+	})
+}
+
+// removeAccountBindings removes all roles and permissions of the account
+// in the transaction tx, queues the events for it and returns what it removed.
+func removeAccountBindings(ctx context.Context, tx dao.DataAccessor, accountId string) (eventhandler.UserDiff, error) {
+	var diff eventhandler.UserDiff
+
+	roleBindings, err := tx.GetUserRoleBindings(ctx, accountId)
+	if err != nil {
+		return diff, status.Errorf(codes.Internal, "could not get user roles bindings: %v", err)
+	}
+	roleIds := make([]string, len(roleBindings))
+	for i, binding := range roleBindings {
+		roleIds[i] = binding.RoleId
+	}
+
+	permBindings, err := tx.GetUserPermissions(ctx, accountId)
+	if err != nil {
+		return diff, status.Errorf(codes.Internal, "could not get user permission bindings: %v", err)
+	}
+	perms := make([]string, len(permBindings))
+	for i, binding := range permBindings {
+		perms[i] = binding.Permission
+	}
+
+	diff.RemovedRoles, err = tx.RemoveUserRoles(ctx, accountId, roleIds)
+	if err != nil {
+		return diff, status.Errorf(codes.Internal, "could not remove user roles: %v", err)
+	}
+	if len(diff.RemovedRoles) > 0 {
+		err := queueUserPermUpdateEvent(ctx, tx, accountId, pb.UserPermissionUpdateEvent_ACTION_ROLE_REMOVED,
+			eventhandler.UserDiff{RemovedRoles: diff.RemovedRoles})
+		if err != nil {
+			return diff, err
+		}
+	}
+
+	diff.RemovedPermissions, err = tx.RemoveUserPermissions(ctx, accountId, perms)
+	if err != nil {
+		return diff, status.Errorf(codes.Internal, "could not remove user permissions: %v", err)
+	}
+	if len(diff.RemovedPermissions) > 0 {
+		err := queueUserPermUpdateEvent(ctx, tx, accountId, pb.UserPermissionUpdateEvent_ACTION_PERM_REMOVED,
+			eventhandler.UserDiff{RemovedPermissions: diff.RemovedPermissions})
+		if err != nil {
+			return diff, err
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cownetwork/indigo/internal/model"
+	"github.com/thoas/go-funk"
+	"sort"
+	"testing"
+)
+
+const (
+	accountId       = "8f5b2c0e-0c3a-4d8e-9a59-1d6f8e0f2a11"
+	targetAccountId = "3c1a7d52-6b0e-4f4f-8f0d-5b8e2e9c7d42"
+	roleId          = "b6f1f5a4-8e2d-4c3b-a1d7-2f9e6c4b8a53"
+)
+
+func newAccountDao() *memoryDao {
+	d := newMemoryDao()
+	d.roles[roleId] = &model.Role{Id: roleId, Name: "default", Type: "test", Permissions: []string{"cow.chat"}}
+	d.userRoles[accountId] = []string{roleId}
+	d.userPermissions[accountId] = []string{"cow.game.start", "cow.game.stop"}
+	return d
+}
+
+// eventExtensions returns the attributes and extensions of the
+// queued events about the account, which are in the JSON format.
+func eventExtensions(t *testing.T, d *memoryDao, accountId string) []map[string]interface{} {
+	t.Helper()
+	var exts []map[string]interface{}
+	for _, e := range d.outbox {
+		if e.Subject != accountId {
+			continue
+		}
+		var ext map[string]interface{}
+		if err := json.Unmarshal(e.Payload, &ext); err != nil {
+			t.Fatalf("could not decode event: %v", err)
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+func hasExtension(exts []map[string]interface{}, name string, value string) bool {
+	for _, ext := range exts {
+		if ext[name] == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sorted(s []string) []string {
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return s
+}
+
+func TestDeleteAccount(t *testing.T) {
+	d := newAccountDao()
+	if err := (AccountHandler{Dao: d}).DeleteAccount(context.Background(), accountId); err != nil {
+		t.Fatalf("DeleteAccount failed: %v", err)
+	}
+
+	if perms := d.userPermissions[accountId]; len(perms) > 0 {
+		t.Errorf("account kept the permissions %v", perms)
+	}
+	if roles := d.userRoles[accountId]; len(roles) > 0 {
+		t.Errorf("account kept the roles %v", roles)
+	}
+
+	exts := eventExtensions(t, d, accountId)
+	if !hasExtension(exts, "removedperms", "cow.game.start,cow.game.stop") {
+		t.Errorf("no event about the removed permissions, got %v", exts)
+	}
+	if !hasExtension(exts, "removedroles", roleId) {
+		t.Errorf("no event about the removed roles, got %v", exts)
+	}
+}
+
+func TestMergeAccount(t *testing.T) {
+	d := newAccountDao()
+	d.userPermissions[targetAccountId] = []string{"cow.game.start"}
+
+	if err := (AccountHandler{Dao: d}).MergeAccount(context.Background(), accountId, targetAccountId); err != nil {
+		t.Fatalf("MergeAccount failed: %v", err)
+	}
+
+	if perms := d.userPermissions[accountId]; len(perms) > 0 {
+		t.Errorf("merged account kept the permissions %v", perms)
+	}
+	if roles := d.userRoles[accountId]; len(roles) > 0 {
+		t.Errorf("merged account kept the roles %v", roles)
+	}
+	if perms := sorted(d.userPermissions[targetAccountId]); !funk.Equal(perms, []string{"cow.game.start", "cow.game.stop"}) {
+		t.Errorf("target account has the permissions %v", perms)
+	}
+	if roles := d.userRoles[targetAccountId]; !funk.Equal(roles, []string{roleId}) {
+		t.Errorf("target account has the roles %v", roles)
+	}
+
+	if exts := eventExtensions(t, d, accountId); !hasExtension(exts, "removedperms", "cow.game.start,cow.game.stop") {
+		t.Errorf("no event about the removed permissions, got %v", exts)
+	}
+	exts := eventExtensions(t, d, targetAccountId)
+	if !hasExtension(exts, "addedperms", "cow.game.stop") {
+		t.Errorf("no event about the added permissions, got %v", exts)
+	}
+	if !hasExtension(exts, "addedroles", roleId) {
+		t.Errorf("no event about the added roles, got %v", exts)
+	}
+}
@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/dao"
+	"google.golang.org/grpc"
+)
+
+const adminServiceName = "cow.indigo.v1.IndigoAdminService"
+
+// AdminService contains the administrative methods of indigo,
+// which are served with the JSON codec.
+type AdminService interface {
+	ListDeadLetters(context.Context, *ListDeadLettersRequest) (*ListDeadLettersResponse, error)
+	RedriveDeadLetters(context.Context, *RedriveDeadLettersRequest) (*RedriveDeadLettersResponse, error)
+	PublishSnapshot(context.Context, *PublishSnapshotRequest) (*PublishSnapshotResponse, error)
+	RegisterWebhook(context.Context, *RegisterWebhookRequest) (*RegisterWebhookResponse, error)
+	ListWebhooks(context.Context, *ListWebhooksRequest) (*ListWebhooksResponse, error)
+	DeleteWebhook(context.Context, *DeleteWebhookRequest) (*DeleteWebhookResponse, error)
+}
+
+type AdminServiceServer struct {
+	Dao dao.DataAccessor
+}
+
+var AdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: adminServiceName,
+	HandlerType: (*AdminService)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod("ListDeadLetters", func() interface{} { return new(ListDeadLettersRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(AdminService).ListDeadLetters(ctx, req.(*ListDeadLettersRequest))
+			}),
+		unaryMethod("RedriveDeadLetters", func() interface{} { return new(RedriveDeadLettersRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(AdminService).RedriveDeadLetters(ctx, req.(*RedriveDeadLettersRequest))
+			}),
+		unaryMethod("PublishSnapshot", func() interface{} { return new(PublishSnapshotRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(AdminService).PublishSnapshot(ctx, req.(*PublishSnapshotRequest))
+			}),
+		unaryMethod("RegisterWebhook", func() interface{} { return new(RegisterWebhookRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(AdminService).RegisterWebhook(ctx, req.(*RegisterWebhookRequest))
+			}),
+		unaryMethod("ListWebhooks", func() interface{} { return new(ListWebhooksRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(AdminService).ListWebhooks(ctx, req.(*ListWebhooksRequest))
+			}),
+		unaryMethod("DeleteWebhook", func() interface{} { return new(DeleteWebhookRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(AdminService).DeleteWebhook(ctx, req.(*DeleteWebhookRequest))
+			}),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "indigo/admin",
+}
+
+// unaryMethod does what protoc-gen-go-grpc generates for every unary method.
+func unaryMethod(name string, newReq func() interface{}, call func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := newReq()
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv, ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + adminServiceName + "/" + name,
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv, ctx, req)
+			}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/auth"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/perm"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// The permissions required to call the methods of indigo.
+const (
+	PermCheck     = "indigo.check"
+	PermRoleRead  = "indigo.role.read"
+	PermRoleWrite = "indigo.role.write"
+	PermUserRead  = "indigo.user.read"
+	PermUserWrite = "indigo.user.write"
+	PermAdmin     = "indigo.admin"
+	PermWatch     = "indigo.watch"
+)
+
+// AssignPermission returns the permission required to
+// add the role with the name to users and remove it again.
+// It has a namespace of its own, as permissions also match
+// the ones they are a part of, e.g. indigo.user.write would
+// match the permission to assign a role named write.
+func AssignPermission(roleName string) string {
+	return "indigo.member." + roleName + ".assign"
+}
+
+var methodPermissions = map[string]string{
+	"HasPermission":         PermCheck,
+	"ListRoles":             PermRoleRead,
+	"GetRole":               PermRoleRead,
+	"InsertRole":            PermRoleWrite,
+	"UpdateRole":            PermRoleWrite,
+	"DeleteRole":            PermRoleWrite,
+	"AddRolePermissions":    PermRoleWrite,
+	"RemoveRolePermissions": PermRoleWrite,
+	"GetUser":               PermUserRead,
+	"GetUserRoles":          PermUserRead,
+	"GetUserPermissions":    PermUserRead,
+	"AddUserPermissions":    PermUserWrite,
+	"RemoveUserPermissions": PermUserWrite,
+}
+
+// Authorizer guards the methods of indigo with the permissions the
+// authenticated caller has in indigo itself. The name of the caller's
+// identity is the account id its roles and permissions are bound to.
+// It has to run after the interceptor of auth.
+type Authorizer struct {
+	Dao dao.DataAccessor
+}
+
+func (a *Authorizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := a.authorize(ctx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authorizer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.authorize(ss.Context(), info.FullMethod, nil); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (a *Authorizer) authorize(ctx context.Context, method string, req interface{}) error {
+	if auth.Exempt(method) {
+		return nil
+	}
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing credentials")
+	}
+
+	perms, err := a.requiredPermissions(ctx, method, req)
+	if err != nil {
+		return err
+	}
+	v, err := callerValidator(ctx, a.Dao, id.Name)
+	if err != nil {
+		return err
+	}
+	for _, p := range perms {
+		if !v.Validate(p) {
+			return status.Errorf(codes.PermissionDenied, "missing permission %s", p)
+		}
+	}
+	return nil
+}
+
+func (a *Authorizer) requiredPermissions(ctx context.Context, method string, req interface{}) ([]string, error) {
+	i := strings.LastIndexByte(method, '/')
+	if i < 1 {
+		return nil, status.Errorf(codes.PermissionDenied, "unknown method %s", method)
+	}
+	service, name := method[1:i], method[i+1:]
+
+	switch service {
+	case adminServiceName:
+		return []string{PermAdmin}, nil
+	case watchServiceName:
+		return []string{PermWatch}, nil
+	case pb.IndigoService_ServiceDesc.ServiceName:
+		if p, ok := methodPermissions[name]; ok {
+			return []string{p}, nil
+		}
+	}
+
+	var roleIds []*pb.RoleIdentifier
+	switch r := req.(type) {
+	case *pb.AddUserRolesRequest:
+		roleIds = r.RoleIds
+	case *pb.RemoveUserRolesRequest:
+		roleIds = r.RoleIds
+	default:
+		// methods which are not known are never allowed
+		return nil, status.Errorf(codes.PermissionDenied, "unknown method %s", method)
+	}
+
+	// the permission to write users is required even if
+	// the request contains no roles or only unknown ones
+	perms := []string{PermUserWrite}
+	for _, roleId := range roleIds {
+		name := roleId.GetNameId().GetName()
+		if len(name) == 0 {
+			role, err := a.Dao.GetRole(ctx, roleId)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
+			}
+			if role == nil {
+				// unknown roles are skipped by the method itself
+				continue
+			}
+			name = role.Name
+		}
+		perms = append(perms, AssignPermission(name))
+	}
+	return perms, nil
+}
+
+// callerValidator returns the validator of the permissions of the
+// account the caller is identified by. Callers which are not
+// identified by an account id do not have any permissions.
+func callerValidator(ctx context.Context, da dao.DataAccessor, name string) (*perm.Validator, error) {
+	if _, err := uuid.Parse(name); err != nil {
+		return perm.NewValidator(nil), nil
+	}
+	user, err := loadProtoUser(ctx, da, name)
+	if err != nil {
+		return nil, err
+	}
+	return perm.NewUserValidator(user), nil
+}
@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/auth"
+	"github.com/cownetwork/indigo/internal/model"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestAuthorizeUserRoles(t *testing.T) {
+	known := &pb.RoleIdentifier{Id: &pb.RoleIdentifier_NameId{NameId: &pb.RoleNameIdentifier{Name: "default", Type: "test"}}}
+	unknown := &pb.RoleIdentifier{Id: &pb.RoleIdentifier_Uuid{Uuid: "0d7c3b1e-5a4f-4e2b-9c8d-7f6a5b4c3d21"}}
+
+	tests := []struct {
+		name    string
+		perms   []string
+		roleIds []*pb.RoleIdentifier
+		code    codes.Code
+	}{
+		{"no roles", []string{PermUserWrite}, nil, codes.OK},
+		{"no roles without write", nil, nil, codes.PermissionDenied},
+		{"unknown role without write", nil, []*pb.RoleIdentifier{unknown}, codes.PermissionDenied},
+		{"unknown role", []string{PermUserWrite}, []*pb.RoleIdentifier{unknown}, codes.OK},
+		{"assign without write", []string{AssignPermission("default")}, []*pb.RoleIdentifier{known}, codes.PermissionDenied},
+		{"write without assign", []string{PermUserWrite}, []*pb.RoleIdentifier{known}, codes.PermissionDenied},
+		{"write and assign", []string{PermUserWrite, AssignPermission("default")}, []*pb.RoleIdentifier{known}, codes.OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newMemoryDao()
+			d.roles[roleId] = &model.Role{Id: roleId, Name: "default", Type: "test"}
+			d.userPermissions[accountId] = test.perms
+			a := &Authorizer{Dao: d}
+			ctx := auth.NewContext(context.Background(), &auth.Identity{Name: accountId})
+
+			for _, method := range []string{"AddUserRoles", "RemoveUserRoles"} {
+				var req interface{} = &pb.AddUserRolesRequest{UserAccountId: targetAccountId, RoleIds: test.roleIds}
+				if method == "RemoveUserRoles" {
+					req = &pb.RemoveUserRolesRequest{UserAccountId: targetAccountId, RoleIds: test.roleIds}
+				}
+				err := a.authorize(ctx, "/"+pb.IndigoService_ServiceDesc.ServiceName+"/"+method, req)
+				if code := status.Code(err); code != test.code {
+					t.Errorf("%s returned %v, want %v", method, err, test.code)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizeRoleNamedLikePermission(t *testing.T) {
+	d := newMemoryDao()
+	d.userPermissions[accountId] = []string{PermUserRead, PermUserWrite, PermRoleRead, PermRoleWrite}
+	a := &Authorizer{Dao: d}
+	ctx := auth.NewContext(context.Background(), &auth.Identity{Name: accountId})
+
+	for _, name := range []string{"read", "write"} {
+		d.roles[roleId] = &model.Role{Id: roleId, Name: name, Type: "test"}
+		req := &pb.AddUserRolesRequest{
+			UserAccountId: targetAccountId,
+			RoleIds:       []*pb.RoleIdentifier{model.ToRoleNameIdentifier(name, "test")},
+		}
+		err := a.authorize(ctx, "/"+pb.IndigoService_ServiceDesc.ServiceName+"/AddUserRoles", req)
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("assigning the role %s returned %v, want %v", name, err, codes.PermissionDenied)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/model"
+	"github.com/cownetwork/indigo/internal/reqmeta"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+)
+
+const (
+	SuperuserRoleName = "superuser"
+	SuperuserRoleType = "indigo"
+)
+
+// BootstrapSuperuser makes sure that the superuser role, which has every
+// permission, exists and is bound to the account, so that the account can
+// grant the permissions to call indigo once it is guarded by them.
+func BootstrapSuperuser(ctx context.Context, da dao.DataAccessor, accountId string) error {
+	ctx = reqmeta.NewContext(ctx, &reqmeta.Meta{
+		RequestId: uuid.New().String(),
+		Actor:     "indigo",
+	})
+	serv := IndigoServiceServer{Dao: da}
+	roleId := model.ToRoleNameIdentifier(SuperuserRoleName, SuperuserRoleType)
+
+	res, err := serv.GetRole(ctx, &pb.GetRoleRequest{RoleId: roleId})
+	if status.Code(err) == codes.NotFound {
+		var inserted *pb.InsertRoleResponse
+		inserted, err = serv.InsertRole(ctx, &pb.InsertRoleRequest{Role: &pb.Role{
+			Name:        SuperuserRoleName,
+			Type:        SuperuserRoleType,
+			Priority:    math.MaxInt32,
+			Permissions: []string{"*"},
+		}})
+		res = &pb.GetRoleResponse{Role: inserted.GetInsertedRole()}
+	}
+	if err != nil {
+		return err
+	}
+
+	bindings, err := da.GetUserRoleBindings(ctx, accountId)
+	if err != nil {
+		return status.Errorf(codes.Internal, "could not get user roles bindings: %v", err)
+	}
+	for _, binding := range bindings {
+		if binding.RoleId == res.Role.Id {
+			return nil
+		}
+	}
+	_, err = serv.AddUserRoles(ctx, &pb.AddUserRolesRequest{
+		UserAccountId: accountId,
+		RoleIds:       []*pb.RoleIdentifier{roleId},
+	})
+	return err
+}
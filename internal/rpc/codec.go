@@ -0,0 +1,27 @@
+package rpc
+
+import (
+	"encoding/json"
+	"google.golang.org/grpc/encoding"
+)
+
+// jsonCodec is used by the services which are not part of mooapis.
+// Clients select it with the `application/grpc+json` content type,
+// e.g. by calling with grpc.CallContentSubtype("json").
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/model"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"github.com/thoas/go-funk"
+	"sort"
+	"sync"
+)
+
+// memoryDao keeps the roles and the bindings of users in memory. The
+// methods which are not needed by the tests panic, as the embedded
+// DataAccessor is nil. Transactions are not isolated.
+type memoryDao struct {
+	dao.DataAccessor
+
+	mu              sync.Mutex
+	roles           map[string]*model.Role
+	userRoles       map[string][]string
+	userPermissions map[string][]string
+	sequences       map[string]int64
+	outbox          []*model.OutboxEvent
+	horizon         int64
+}
+
+func newMemoryDao() *memoryDao {
+	return &memoryDao{
+		roles:           map[string]*model.Role{},
+		userRoles:       map[string][]string{},
+		userPermissions: map[string][]string{},
+		sequences:       map[string]int64{},
+	}
+}
+
+func (d *memoryDao) Tx(_ context.Context, fn func(tx dao.DataAccessor) error) error {
+	return fn(d)
+}
+
+func (d *memoryDao) GetRole(_ context.Context, roleId *pb.RoleIdentifier) (*model.Role, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, role := range d.roles {
+		if role.Id == roleId.GetUuid() ||
+			(role.Name == roleId.GetNameId().GetName() && role.Type == roleId.GetNameId().GetType()) {
+			c := *role
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *memoryDao) GetRolePermissions(_ context.Context, roleId string) ([]*model.RolePermissionBinding, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var bindings []*model.RolePermissionBinding
+	if role, ok := d.roles[roleId]; ok {
+		for _, p := range role.Permissions {
+			bindings = append(bindings, &model.RolePermissionBinding{RoleId: roleId, Permission: p})
+		}
+	}
+	return bindings, nil
+}
+
+func (d *memoryDao) GetUserRoleBindings(_ context.Context, userAccountId string) ([]*model.UserRoleBinding, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var bindings []*model.UserRoleBinding
+	for _, id := range d.userRoles[userAccountId] {
+		bindings = append(bindings, &model.UserRoleBinding{UserAccountId: userAccountId, RoleId: id})
+	}
+	return bindings, nil
+}
+
+func (d *memoryDao) AddUserRoles(_ context.Context, userAccountId string, roleIds []string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	added := funk.SubtractString(roleIds, d.userRoles[userAccountId])
+	d.userRoles[userAccountId] = append(d.userRoles[userAccountId], added...)
+	return added, nil
+}
+
+func (d *memoryDao) RemoveUserRoles(_ context.Context, userAccountId string, roleIds []string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed := funk.IntersectString(d.userRoles[userAccountId], roleIds)
+	d.userRoles[userAccountId] = funk.SubtractString(d.userRoles[userAccountId], removed)
+	return removed, nil
+}
+
+func (d *memoryDao) GetUserPermissions(_ context.Context, userAccountId string) ([]*model.UserPermissionBinding, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var bindings []*model.UserPermissionBinding
+	for _, p := range d.userPermissions[userAccountId] {
+		bindings = append(bindings, &model.UserPermissionBinding{UserAccountId: userAccountId, Permission: p})
+	}
+	return bindings, nil
+}
+
+func (d *memoryDao) AddUserPermissions(_ context.Context, userAccountId string, permissions []string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	added := funk.SubtractString(permissions, d.userPermissions[userAccountId])
+	d.userPermissions[userAccountId] = append(d.userPermissions[userAccountId], added...)
+	return added, nil
+}
+
+func (d *memoryDao) RemoveUserPermissions(_ context.Context, userAccountId string, permissions []string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed := funk.IntersectString(d.userPermissions[userAccountId], permissions)
+	d.userPermissions[userAccountId] = funk.SubtractString(d.userPermissions[userAccountId], removed)
+	return removed, nil
+}
+
+func (d *memoryDao) NextEventSequence(_ context.Context, entity string) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sequences[entity]++
+	return d.sequences[entity], nil
+}
+
+func (d *memoryDao) InsertOutboxEvent(_ context.Context, event *model.OutboxEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	event.Id = int64(len(d.outbox) + 1)
+	d.outbox = append(d.outbox, event)
+	return nil
+}
+
+func (d *memoryDao) GetOutboxEventsAfter(_ context.Context, position int64, filter model.OutboxFilter, limit int) ([]*model.OutboxEvent, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var events []*model.OutboxEvent
+	for _, e := range d.outbox {
+		if e.Position == nil || *e.Position <= position || e.DeadAt != nil ||
+			(len(filter.Subjects) > 0 && !funk.ContainsString(filter.Subjects, e.Subject)) ||
+			(len(filter.Types) > 0 && !funk.ContainsString(filter.Types, e.Type)) {
+			continue
+		}
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return *events[i].Position < *events[j].Position
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (d *memoryDao) GetLatestOutboxPosition(_ context.Context) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	latest := d.horizon
+	for _, e := range d.outbox {
+		if e.Position != nil && *e.Position > latest {
+			latest = *e.Position
+		}
+	}
+	return latest, nil
+}
+
+func (d *memoryDao) GetOutboxHorizon(_ context.Context) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.horizon, nil
+}
@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const defaultDeadLetterLimit = 100
+
+type DeadLetter struct {
+	Id        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Event     json.RawMessage `json:"event"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	CreatedAt time.Time       `json:"created_at"`
+	DeadAt    time.Time       `json:"dead_at"`
+}
+
+type ListDeadLettersRequest struct {
+	Limit int `json:"limit"`
+}
+
+type ListDeadLettersResponse struct {
+	DeadLetters []*DeadLetter `json:"dead_letters"`
+}
+
+type RedriveDeadLettersRequest struct {
+	// Ids of the dead letters to re-drive. All are re-driven if empty.
+	Ids []int64 `json:"ids"`
+}
+
+type RedriveDeadLettersResponse struct {
+	Redriven int64 `json:"redriven"`
+}
+
+func (serv AdminServiceServer) ListDeadLetters(ctx context.Context, req *ListDeadLettersRequest) (*ListDeadLettersResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultDeadLetterLimit
+	}
+
+	events, err := serv.Dao.GetDeadOutboxEvents(ctx, limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not get dead letters: %v", err)
+	}
+
+	deadLetters := make([]*DeadLetter, len(events))
+	for i, e := range events {
+		deadLetters[i] = &DeadLetter{
+			Id:        e.Id,
+			Type:      e.Type,
+			Event:     e.Payload,
+			Attempts:  e.Attempts,
+			LastError: e.LastError,
+			CreatedAt: e.CreatedAt,
+		}
+		if e.DeadAt != nil {
+			deadLetters[i].DeadAt = *e.DeadAt
+		}
+	}
+
+	return &ListDeadLettersResponse{
+		DeadLetters: deadLetters,
+	}, nil
+}
+
+func (serv AdminServiceServer) RedriveDeadLetters(ctx context.Context, req *RedriveDeadLettersRequest) (*RedriveDeadLettersResponse, error) {
+	n, err := serv.Dao.RedriveOutboxEvents(ctx, req.Ids)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not re-drive dead letters: %v", err)
+	}
+
+	return &RedriveDeadLettersResponse{
+		Redriven: n,
+	}, nil
+}
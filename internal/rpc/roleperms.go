@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"github.com/cownetwork/indigo/internal/dao"
 	"github.com/cownetwork/indigo/internal/eventhandler"
 	"github.com/cownetwork/indigo/internal/perm"
 	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
@@ -10,8 +11,8 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func (serv IndigoServiceServer) AddRolePermissions(_ context.Context, req *pb.AddRolePermissionsRequest) (*pb.AddRolePermissionsResponse, error) {
-	role, err := serv.Dao.GetRole(req.RoleId)
+func (serv IndigoServiceServer) AddRolePermissions(ctx context.Context, req *pb.AddRolePermissionsRequest) (*pb.AddRolePermissionsResponse, error) {
+	role, err := serv.Dao.GetRole(ctx, req.RoleId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
 	}
@@ -19,7 +20,7 @@ func (serv IndigoServiceServer) AddRolePermissions(_ context.Context, req *pb.Ad
 		return nil, status.Error(codes.NotFound, "this role does not exists")
 	}
 
-	bindings, err := serv.Dao.GetRolePermissions(role.Id)
+	bindings, err := serv.Dao.GetRolePermissions(ctx, role.Id)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role permissions: %v", err)
 	}
@@ -30,21 +31,38 @@ func (serv IndigoServiceServer) AddRolePermissions(_ context.Context, req *pb.Ad
 		return perm.ValidatePermission(s)
 	})
 
-	addedPerms, err := serv.Dao.AddRolePermissions(role.Id, perms)
+	var addedPerms []string
+	err = serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		addedPerms, err = tx.AddRolePermissions(ctx, role.Id, perms)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not add permissions: %v", err)
+		}
+		role.AddPermissions(addedPerms)
+
+		err = queueRoleUpdateEvent(ctx, tx, role, pb.RoleUpdateEvent_ACTION_UPDATED,
+			eventhandler.RoleDiff{AddedPermissions: addedPerms})
+		if err != nil || len(addedPerms) == 0 {
+			return err
+		}
+
+		members, err := tx.GetRoleUserBindings(ctx, role.Id)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not get role members: %v", err)
+		}
+		return queueRoleMemberEvents(ctx, tx, role.Id, members, pb.UserPermissionUpdateEvent_ACTION_PERM_ADDED,
+			eventhandler.UserDiff{AddedPermissions: addedPerms})
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not add permissions: %v", err)
+		return nil, err
 	}
-	role.AddPermissions(addedPerms)
-
-	eventhandler.SendRoleUpdateEvent(role.ToProtoRole(), pb.RoleUpdateEvent_ACTION_UPDATED)
 
 	return &pb.AddRolePermissionsResponse{
 		AddedPermissions: addedPerms,
 	}, nil
 }
 
-func (serv IndigoServiceServer) RemoveRolePermissions(_ context.Context, req *pb.RemoveRolePermissionsRequest) (*pb.RemoveRolePermissionsResponse, error) {
-	role, err := serv.Dao.GetRole(req.RoleId)
+func (serv IndigoServiceServer) RemoveRolePermissions(ctx context.Context, req *pb.RemoveRolePermissionsRequest) (*pb.RemoveRolePermissionsResponse, error) {
+	role, err := serv.Dao.GetRole(ctx, req.RoleId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
 	}
@@ -52,19 +70,36 @@ func (serv IndigoServiceServer) RemoveRolePermissions(_ context.Context, req *pb
 		return nil, status.Error(codes.NotFound, "this role does not exists")
 	}
 
-	bindings, err := serv.Dao.GetRolePermissions(role.Id)
+	bindings, err := serv.Dao.GetRolePermissions(ctx, role.Id)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role permissions: %v", err)
 	}
 	role.SetPermissions(bindings)
 
-	removedPerms, err := serv.Dao.RemoveRolePermissions(role.Id, req.Permissions)
+	var removedPerms []string
+	err = serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		removedPerms, err = tx.RemoveRolePermissions(ctx, role.Id, req.Permissions)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not remove permissions: %v", err)
+		}
+		role.RemovePermissions(removedPerms)
+
+		err = queueRoleUpdateEvent(ctx, tx, role, pb.RoleUpdateEvent_ACTION_UPDATED,
+			eventhandler.RoleDiff{RemovedPermissions: removedPerms})
+		if err != nil || len(removedPerms) == 0 {
+			return err
+		}
+
+		members, err := tx.GetRoleUserBindings(ctx, role.Id)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not get role members: %v", err)
+		}
+		return queueRoleMemberEvents(ctx, tx, role.Id, members, pb.UserPermissionUpdateEvent_ACTION_PERM_REMOVED,
+			eventhandler.UserDiff{RemovedPermissions: removedPerms})
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not remove permissions: %v", err)
+		return nil, err
 	}
-	role.RemovePermissions(removedPerms)
-
-	eventhandler.SendRoleUpdateEvent(role.ToProtoRole(), pb.RoleUpdateEvent_ACTION_UPDATED)
 
 	return &pb.RemoveRolePermissionsResponse{
 		RemovedPermissions: removedPerms,
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"github.com/cownetwork/indigo/internal/dao"
 	"github.com/cownetwork/indigo/internal/eventhandler"
 	"github.com/cownetwork/indigo/internal/model"
 	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
@@ -11,14 +12,14 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func (serv IndigoServiceServer) ListRoles(_ context.Context, req *pb.ListRolesRequest) (*pb.ListRolesResponse, error) {
-	roles, err := serv.Dao.ListRoles()
+func (serv IndigoServiceServer) ListRoles(ctx context.Context, req *pb.ListRolesRequest) (*pb.ListRolesResponse, error) {
+	roles, err := serv.Dao.ListRoles(ctx)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not list roles: %v", err)
 	}
 
 	for _, role := range roles {
-		perms, err := serv.Dao.GetRolePermissions(role.Id)
+		perms, err := serv.Dao.GetRolePermissions(ctx, role.Id)
 		if err != nil {
 			continue
 		}
@@ -36,8 +37,8 @@ func (serv IndigoServiceServer) ListRoles(_ context.Context, req *pb.ListRolesRe
 	}, nil
 }
 
-func (serv IndigoServiceServer) GetRole(_ context.Context, req *pb.GetRoleRequest) (*pb.GetRoleResponse, error) {
-	role, err := serv.Dao.GetRole(req.RoleId)
+func (serv IndigoServiceServer) GetRole(ctx context.Context, req *pb.GetRoleRequest) (*pb.GetRoleResponse, error) {
+	role, err := serv.Dao.GetRole(ctx, req.RoleId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
 	}
@@ -45,7 +46,7 @@ func (serv IndigoServiceServer) GetRole(_ context.Context, req *pb.GetRoleReques
 		return nil, status.Errorf(codes.NotFound, "could not find role")
 	}
 
-	bindings, err := serv.Dao.GetRolePermissions(role.Id)
+	bindings, err := serv.Dao.GetRolePermissions(ctx, role.Id)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role permissions: %v", err)
 	}
@@ -56,7 +57,7 @@ func (serv IndigoServiceServer) GetRole(_ context.Context, req *pb.GetRoleReques
 	}, nil
 }
 
-func (serv IndigoServiceServer) InsertRole(_ context.Context, req *pb.InsertRoleRequest) (*pb.InsertRoleResponse, error) {
+func (serv IndigoServiceServer) InsertRole(ctx context.Context, req *pb.InsertRoleRequest) (*pb.InsertRoleResponse, error) {
 	role := model.FromProtoRole(req.Role)
 
 	err := ValidateRole(role)
@@ -64,7 +65,7 @@ func (serv IndigoServiceServer) InsertRole(_ context.Context, req *pb.InsertRole
 		return nil, err
 	}
 
-	r, err := serv.Dao.GetRole(model.ToRoleNameIdentifier(role.Name, role.Type))
+	r, err := serv.Dao.GetRole(ctx, model.ToRoleNameIdentifier(role.Name, role.Type))
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
 	}
@@ -78,28 +79,34 @@ func (serv IndigoServiceServer) InsertRole(_ context.Context, req *pb.InsertRole
 	}
 	role.Id = roleUuid.String()
 
-	err = serv.Dao.InsertRole(role)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not insert role: %v", err)
-	}
-
-	if len(req.Role.Permissions) > 0 {
-		_, err = serv.Dao.AddRolePermissions(role.Id, role.Permissions)
+	err = serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		err := tx.InsertRole(ctx, role)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "could not initialize role permissions: %v", err)
+			return status.Errorf(codes.Internal, "could not insert role: %v", err)
 		}
-	}
 
-	pr := role.ToProtoRole()
-	eventhandler.SendRoleUpdateEvent(pr, pb.RoleUpdateEvent_ACTION_ADDED)
+		var addedPerms []string
+		if len(req.Role.Permissions) > 0 {
+			addedPerms, err = tx.AddRolePermissions(ctx, role.Id, role.Permissions)
+			if err != nil {
+				return status.Errorf(codes.Internal, "could not initialize role permissions: %v", err)
+			}
+		}
+
+		return queueRoleUpdateEvent(ctx, tx, role, pb.RoleUpdateEvent_ACTION_ADDED,
+			eventhandler.RoleDiff{AddedPermissions: addedPerms})
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &pb.InsertRoleResponse{
-		InsertedRole: pr,
+		InsertedRole: role.ToProtoRole(),
 	}, nil
 }
 
-func (serv IndigoServiceServer) UpdateRole(_ context.Context, req *pb.UpdateRoleRequest) (*pb.UpdateRoleResponse, error) {
-	role, err := serv.Dao.GetRole(req.RoleId)
+func (serv IndigoServiceServer) UpdateRole(ctx context.Context, req *pb.UpdateRoleRequest) (*pb.UpdateRoleResponse, error) {
+	role, err := serv.Dao.GetRole(ctx, req.RoleId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
 	}
@@ -107,12 +114,13 @@ func (serv IndigoServiceServer) UpdateRole(_ context.Context, req *pb.UpdateRole
 		return nil, status.Errorf(codes.NotFound, "could not find role")
 	}
 
-	bindings, err := serv.Dao.GetRolePermissions(role.Id)
+	bindings, err := serv.Dao.GetRolePermissions(ctx, role.Id)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role permissions: %v", err)
 	}
 	role.SetPermissions(bindings)
 
+	prev := role.ToProtoRole()
 	prevPerms := append([]string(nil), role.Permissions...)
 	for _, mask := range req.FieldMasks {
 		role.Merge(req.RoleData, mask)
@@ -124,34 +132,63 @@ func (serv IndigoServiceServer) UpdateRole(_ context.Context, req *pb.UpdateRole
 		return nil, err
 	}
 
-	err = serv.Dao.UpdateRole(req.RoleId, role)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not update role: %v", err)
-	}
-
-	if funk.Contains(req.FieldMasks, pb.UpdateRoleRequest_FIELD_MASK_ALL) ||
-		funk.Contains(req.FieldMasks, pb.UpdateRoleRequest_FIELD_MASK_PERMISSIONS) {
-		_, err = serv.Dao.AddRolePermissions(role.Id, added)
+	err = serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		err := tx.UpdateRole(ctx, req.RoleId, role)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "could not update role permissions: %v", err)
+			return status.Errorf(codes.Internal, "could not update role: %v", err)
+		}
+
+		var addedPerms, removedPerms []string
+		if funk.Contains(req.FieldMasks, pb.UpdateRoleRequest_FIELD_MASK_ALL) ||
+			funk.Contains(req.FieldMasks, pb.UpdateRoleRequest_FIELD_MASK_PERMISSIONS) {
+			addedPerms, err = tx.AddRolePermissions(ctx, role.Id, added)
+			if err != nil {
+				return status.Errorf(codes.Internal, "could not update role permissions: %v", err)
+			}
+
+			removedPerms, err = tx.RemoveRolePermissions(ctx, role.Id, removed)
+			if err != nil {
+				return status.Errorf(codes.Internal, "could not update role permissions: %v", err)
+			}
+		}
+
+		err = queueRoleUpdateEvent(ctx, tx, role, pb.RoleUpdateEvent_ACTION_UPDATED, eventhandler.RoleDiff{
+			Previous:           prev,
+			AddedPermissions:   addedPerms,
+			RemovedPermissions: removedPerms,
+		})
+		if err != nil || (len(addedPerms) == 0 && len(removedPerms) == 0) {
+			return err
 		}
 
-		_, err = serv.Dao.RemoveRolePermissions(role.Id, removed)
+		members, err := tx.GetRoleUserBindings(ctx, role.Id)
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "could not update role permissions: %v", err)
+			return status.Errorf(codes.Internal, "could not get role members: %v", err)
 		}
+		if len(addedPerms) > 0 {
+			err = queueRoleMemberEvents(ctx, tx, role.Id, members, pb.UserPermissionUpdateEvent_ACTION_PERM_ADDED,
+				eventhandler.UserDiff{AddedPermissions: addedPerms})
+			if err != nil {
+				return err
+			}
+		}
+		if len(removedPerms) > 0 {
+			err = queueRoleMemberEvents(ctx, tx, role.Id, members, pb.UserPermissionUpdateEvent_ACTION_PERM_REMOVED,
+				eventhandler.UserDiff{RemovedPermissions: removedPerms})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	r := role.ToProtoRole()
-	eventhandler.SendRoleUpdateEvent(r, pb.RoleUpdateEvent_ACTION_UPDATED)
-
 	return &pb.UpdateRoleResponse{
-		UpdatedRole: r,
+		UpdatedRole: role.ToProtoRole(),
 	}, nil
 }
 
-func (serv IndigoServiceServer) DeleteRole(_ context.Context, req *pb.DeleteRoleRequest) (*pb.DeleteRoleResponse, error) {
-	role, err := serv.Dao.GetRole(req.RoleId)
+func (serv IndigoServiceServer) DeleteRole(ctx context.Context, req *pb.DeleteRoleRequest) (*pb.DeleteRoleResponse, error) {
+	role, err := serv.Dao.GetRole(ctx, req.RoleId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
 	}
@@ -159,12 +196,27 @@ func (serv IndigoServiceServer) DeleteRole(_ context.Context, req *pb.DeleteRole
 		return nil, status.Error(codes.NotFound, "this role does not exists")
 	}
 
-	err = serv.Dao.DeleteRole(role.Id)
+	err = serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		members, err := tx.GetRoleUserBindings(ctx, role.Id)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not get role members: %v", err)
+		}
+
+		err = tx.DeleteRole(ctx, role.Id)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not delete role: %v", err)
+		}
+
+		err = queueRoleUpdateEvent(ctx, tx, role, pb.RoleUpdateEvent_ACTION_DELETED, eventhandler.RoleDiff{})
+		if err != nil {
+			return err
+		}
+		return queueRoleMemberEvents(ctx, tx, role.Id, members, pb.UserPermissionUpdateEvent_ACTION_ROLE_REMOVED,
+			eventhandler.UserDiff{RemovedRoles: []string{role.Id}})
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not delete role: %v", err)
+		return nil, err
 	}
 
-	eventhandler.SendRoleUpdateEvent(role.ToProtoRole(), pb.RoleUpdateEvent_ACTION_DELETED)
-
 	return &pb.DeleteRoleResponse{}, nil
 }
@@ -1,9 +1,12 @@
 package rpc
 
 import (
+	"context"
 	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/eventhandler"
 	"github.com/cownetwork/indigo/internal/model"
 	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"github.com/thoas/go-funk"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"regexp"
@@ -30,3 +33,71 @@ func ValidateRole(r *model.Role) error {
 	}
 	return nil
 }
+
+// queueRoleUpdateEvent queues a RoleUpdateEvent for role
+// in the outbox of the transaction tx.
+func queueRoleUpdateEvent(ctx context.Context, tx dao.DataAccessor, role *model.Role, action pb.RoleUpdateEvent_Action, diff eventhandler.RoleDiff) error {
+	err := eventhandler.QueueRoleUpdateEvent(ctx, tx, role.ToProtoRole(), action, diff)
+	if err != nil {
+		return status.Errorf(codes.Internal, "could not queue role update event: %v", err)
+	}
+	return nil
+}
+
+// queueUserPermUpdateEvent queues a UserPermissionUpdateEvent, carrying
+// the user as it is after the change, in the outbox of the transaction tx.
+func queueUserPermUpdateEvent(ctx context.Context, tx dao.DataAccessor, userAccountId string, action pb.UserPermissionUpdateEvent_Action, diff eventhandler.UserDiff) error {
+	user, err := loadProtoUser(ctx, tx, userAccountId)
+	if err != nil {
+		return err
+	}
+
+	err = eventhandler.QueueUserPermUpdateEvent(ctx, tx, user, action, diff)
+	if err != nil {
+		return status.Errorf(codes.Internal, "could not queue user permission update event: %v", err)
+	}
+	return nil
+}
+
+// queueRoleMemberEvents queues a UserPermissionUpdateEvent for every
+// member of the role whose effective permissions changed with the role.
+// Permissions which the member still has from another role or on its own
+// are left out of the diff, and members for which nothing is left get
+// no event. Removing the role from its members always changes them.
+// The members have to be fetched before the change, as a deleted role
+// does not have any members anymore.
+func queueRoleMemberEvents(ctx context.Context, tx dao.DataAccessor, roleId string, members []*model.UserRoleBinding, action pb.UserPermissionUpdateEvent_Action, diff eventhandler.UserDiff) error {
+	for _, member := range members {
+		user, err := loadProtoUser(ctx, tx, member.UserAccountId)
+		if err != nil {
+			return err
+		}
+
+		granted := otherPermissions(user, roleId)
+		memberDiff := diff
+		memberDiff.AddedPermissions = funk.SubtractString(diff.AddedPermissions, granted)
+		memberDiff.RemovedPermissions = funk.SubtractString(diff.RemovedPermissions, granted)
+		if len(memberDiff.AddedRoles) == 0 && len(memberDiff.RemovedRoles) == 0 &&
+			len(memberDiff.AddedPermissions) == 0 && len(memberDiff.RemovedPermissions) == 0 {
+			continue
+		}
+
+		err = eventhandler.QueueUserPermUpdateEvent(ctx, tx, user, action, memberDiff)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not queue user permission update event: %v", err)
+		}
+	}
+	return nil
+}
+
+// otherPermissions returns the permissions the user has
+// from roles other than roleId and on its own.
+func otherPermissions(user *pb.User, roleId string) []string {
+	perms := append([]string(nil), user.CustomPermissions...)
+	for _, role := range user.Roles {
+		if role.Id != roleId {
+			perms = append(perms, role.Permissions...)
+		}
+	}
+	return perms
+}
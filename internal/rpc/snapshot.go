@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/eventhandler"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type PublishSnapshotRequest struct {
+	IncludeUsers bool `json:"include_users"`
+}
+
+type PublishSnapshotResponse struct {
+	Roles int `json:"roles"`
+	Users int `json:"users"`
+}
+
+func (serv AdminServiceServer) PublishSnapshot(ctx context.Context, req *PublishSnapshotRequest) (*PublishSnapshotResponse, error) {
+	roles, users, err := eventhandler.PublishSnapshot(ctx, serv.Dao, req.IncludeUsers)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not publish snapshot: %v", err)
+	}
+
+	return &PublishSnapshotResponse{
+		Roles: roles,
+		Users: users,
+	}, nil
+}
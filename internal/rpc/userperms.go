@@ -2,16 +2,16 @@ package rpc
 
 import (
 	"context"
+	"github.com/cownetwork/indigo/internal/dao"
 	"github.com/cownetwork/indigo/internal/eventhandler"
-	"github.com/cownetwork/indigo/internal/model"
 	"github.com/cownetwork/indigo/internal/perm"
 	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-func (serv IndigoServiceServer) GetUserPermissions(_ context.Context, req *pb.GetUserPermissionsRequest) (*pb.GetUserPermissionsResponse, error) {
-	permBindings, err := serv.Dao.GetUserPermissions(req.UserAccountId)
+func (serv IndigoServiceServer) GetUserPermissions(ctx context.Context, req *pb.GetUserPermissionsRequest) (*pb.GetUserPermissionsResponse, error) {
+	permBindings, err := serv.Dao.GetUserPermissions(ctx, req.UserAccountId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get user permissions: %v", err)
 	}
@@ -24,14 +24,7 @@ func (serv IndigoServiceServer) GetUserPermissions(_ context.Context, req *pb.Ge
 	return &pb.GetUserPermissionsResponse{Permissions: perms}, nil
 }
 
-func (serv IndigoServiceServer) AddUserPermissions(_ context.Context, req *pb.AddUserPermissionsRequest) (*pb.AddUserPermissionsResponse, error) {
-	user := model.NewUser(req.UserAccountId)
-	permBindings, err := serv.Dao.GetUserPermissions(req.UserAccountId)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not get user permissions: %v", err)
-	}
-	user.SetPermissions(permBindings)
-
+func (serv IndigoServiceServer) AddUserPermissions(ctx context.Context, req *pb.AddUserPermissionsRequest) (*pb.AddUserPermissionsResponse, error) {
 	// only take those permissions that match the regex.
 	var perms []string
 	for _, permission := range req.Permissions {
@@ -40,34 +33,41 @@ func (serv IndigoServiceServer) AddUserPermissions(_ context.Context, req *pb.Ad
 		}
 	}
 
-	addedPerms, err := serv.Dao.AddUserPermissions(req.UserAccountId, perms)
+	var addedPerms []string
+	err := serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		var err error
+		addedPerms, err = tx.AddUserPermissions(ctx, req.UserAccountId, perms)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not add user permissions: %v", err)
+		}
+
+		return queueUserPermUpdateEvent(ctx, tx, req.UserAccountId, pb.UserPermissionUpdateEvent_ACTION_PERM_ADDED,
+			eventhandler.UserDiff{AddedPermissions: addedPerms})
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not add user permissions: %v", err)
+		return nil, err
 	}
-	user.AddPermissions(addedPerms)
-
-	eventhandler.SendUserPermUpdateEvent(user.ToProtoUser(), pb.UserPermissionUpdateEvent_ACTION_PERM_ADDED)
 
 	return &pb.AddUserPermissionsResponse{
 		AddedPermissions: addedPerms,
 	}, nil
 }
 
-func (serv IndigoServiceServer) RemoveUserPermissions(_ context.Context, req *pb.RemoveUserPermissionsRequest) (*pb.RemoveUserPermissionsResponse, error) {
-	user := model.NewUser(req.UserAccountId)
-	permBindings, err := serv.Dao.GetUserPermissions(req.UserAccountId)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not get user permissions: %v", err)
-	}
-	user.SetPermissions(permBindings)
+func (serv IndigoServiceServer) RemoveUserPermissions(ctx context.Context, req *pb.RemoveUserPermissionsRequest) (*pb.RemoveUserPermissionsResponse, error) {
+	var removedPerms []string
+	err := serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		var err error
+		removedPerms, err = tx.RemoveUserPermissions(ctx, req.UserAccountId, req.Permissions)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not remove user permissions: %v", err)
+		}
 
-	removedPerms, err := serv.Dao.RemoveUserPermissions(req.UserAccountId, req.Permissions)
+		return queueUserPermUpdateEvent(ctx, tx, req.UserAccountId, pb.UserPermissionUpdateEvent_ACTION_PERM_REMOVED,
+			eventhandler.UserDiff{RemovedPermissions: removedPerms})
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not remove user permissions: %v", err)
+		return nil, err
 	}
-	user.RemovePermissions(removedPerms)
-
-	eventhandler.SendUserPermUpdateEvent(user.ToProtoUser(), pb.UserPermissionUpdateEvent_ACTION_PERM_REMOVED)
 
 	return &pb.RemoveUserPermissionsResponse{
 		RemovedPermissions: removedPerms,
@@ -10,29 +10,25 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func (serv IndigoServiceServer) GetUserRoles(_ context.Context, req *pb.GetUserRolesRequest) (*pb.GetUserRolesResponse, error) {
-	roleBindings, err := serv.Dao.GetUserRoleBindings(req.UserAccountId)
+func (serv IndigoServiceServer) GetUserRoles(ctx context.Context, req *pb.GetUserRolesRequest) (*pb.GetUserRolesResponse, error) {
+	roleBindings, err := serv.Dao.GetUserRoleBindings(ctx, req.UserAccountId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get user roles bindings: %v", err)
 	}
-	protoRoles := UserRoleBindingsToProtoRoles(serv.Dao, roleBindings)
+	protoRoles, err := UserRoleBindingsToProtoRoles(ctx, serv.Dao, roleBindings)
+	if err != nil {
+		return nil, err
+	}
 
 	return &pb.GetUserRolesResponse{
 		Roles: protoRoles,
 	}, nil
 }
 
-func (serv IndigoServiceServer) AddUserRoles(_ context.Context, req *pb.AddUserRolesRequest) (*pb.AddUserRolesResponse, error) {
-	user := model.NewUser(req.UserAccountId)
-	roleBindings, err := serv.Dao.GetUserRoleBindings(req.UserAccountId)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not get user roles bindings: %v", err)
-	}
-	user.SetRoles(roleBindings)
-
+func (serv IndigoServiceServer) AddUserRoles(ctx context.Context, req *pb.AddUserRolesRequest) (*pb.AddUserRolesResponse, error) {
 	var roleIds []string
 	for _, id := range req.RoleIds {
-		r, err := serv.Dao.GetRole(id)
+		r, err := serv.Dao.GetRole(ctx, id)
 		if err != nil {
 			continue
 		}
@@ -42,30 +38,30 @@ func (serv IndigoServiceServer) AddUserRoles(_ context.Context, req *pb.AddUserR
 		return nil, status.Error(codes.NotFound, "could not find any roles")
 	}
 
-	addedRoles, err := serv.Dao.AddUserRoles(req.UserAccountId, roleIds)
+	var addedRoles []string
+	err := serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		var err error
+		addedRoles, err = tx.AddUserRoles(ctx, req.UserAccountId, roleIds)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not add user roles: %v", err)
+		}
+
+		return queueUserPermUpdateEvent(ctx, tx, req.UserAccountId, pb.UserPermissionUpdateEvent_ACTION_ROLE_ADDED,
+			eventhandler.UserDiff{AddedRoles: addedRoles})
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not add user roles: %v", err)
+		return nil, err
 	}
-	user.AddRoles(addedRoles)
-
-	eventhandler.SendUserPermUpdateEvent(user.ToProtoUser(), pb.UserPermissionUpdateEvent_ACTION_ROLE_ADDED)
 
 	return &pb.AddUserRolesResponse{
 		AddedRoleIds: addedRoles,
 	}, nil
 }
 
-func (serv IndigoServiceServer) RemoveUserRoles(_ context.Context, req *pb.RemoveUserRolesRequest) (*pb.RemoveUserRolesResponse, error) {
-	user := model.NewUser(req.UserAccountId)
-	roleBindings, err := serv.Dao.GetUserRoleBindings(req.UserAccountId)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not get user roles bindings: %v", err)
-	}
-	user.SetRoles(roleBindings)
-
+func (serv IndigoServiceServer) RemoveUserRoles(ctx context.Context, req *pb.RemoveUserRolesRequest) (*pb.RemoveUserRolesResponse, error) {
 	var roleIds []string
 	for _, id := range req.RoleIds {
-		r, err := serv.Dao.GetRole(id)
+		r, err := serv.Dao.GetRole(ctx, id)
 		if err != nil {
 			continue
 		}
@@ -75,13 +71,20 @@ func (serv IndigoServiceServer) RemoveUserRoles(_ context.Context, req *pb.Remov
 		return nil, status.Error(codes.NotFound, "could not find any roles")
 	}
 
-	removedRoles, err := serv.Dao.RemoveUserRoles(req.UserAccountId, roleIds)
+	var removedRoles []string
+	err := serv.Dao.Tx(ctx, func(tx dao.DataAccessor) error {
+		var err error
+		removedRoles, err = tx.RemoveUserRoles(ctx, req.UserAccountId, roleIds)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not add user roles: %v", err)
+		}
+
+		return queueUserPermUpdateEvent(ctx, tx, req.UserAccountId, pb.UserPermissionUpdateEvent_ACTION_ROLE_REMOVED,
+			eventhandler.UserDiff{RemovedRoles: removedRoles})
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not add user roles: %v", err)
+		return nil, err
 	}
-	user.RemoveRoles(removedRoles)
-
-	eventhandler.SendUserPermUpdateEvent(user.ToProtoUser(), pb.UserPermissionUpdateEvent_ACTION_ROLE_REMOVED)
 
 	return &pb.RemoveUserRolesResponse{
 		RemovedRoleIds: removedRoles,
@@ -90,15 +93,19 @@ func (serv IndigoServiceServer) RemoveUserRoles(_ context.Context, req *pb.Remov
 
 // UserRoleBindingsToProtoRoles fetches a role for
 // every binding and that way fills in the permissions as well.
-func UserRoleBindingsToProtoRoles(da dao.DataAccessor, roleBindings []*model.UserRoleBinding) []*pb.Role {
+func UserRoleBindingsToProtoRoles(ctx context.Context, da dao.DataAccessor, roleBindings []*model.UserRoleBinding) ([]*pb.Role, error) {
 	var protoRoles []*pb.Role
 	for _, binding := range roleBindings {
-		role, err := da.GetRole(model.ToRoleUuidIdentifier(binding.RoleId))
-		if err != nil || role == nil {
+		role, err := da.GetRole(ctx, model.ToRoleUuidIdentifier(binding.RoleId))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
+		}
+		if role == nil {
+			// the role has been deleted in the meantime
 			continue
 		}
 
 		protoRoles = append(protoRoles, role.ToProtoRole())
 	}
-	return protoRoles
+	return protoRoles, nil
 }
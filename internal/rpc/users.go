@@ -2,23 +2,41 @@ package rpc
 
 import (
 	"context"
-	"github.com/cownetwork/indigo/internal/model"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/metrics"
 	"github.com/cownetwork/indigo/internal/perm"
 	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-func (serv IndigoServiceServer) GetUser(_ context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
-	roleBindings, err := serv.Dao.GetUserRoleBindings(req.UserAccountId)
+func (serv IndigoServiceServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	user, err := loadProtoUser(ctx, serv.Dao, req.UserAccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetUserResponse{
+		User: user,
+	}, nil
+}
+
+// loadProtoUser fetches the user with its roles,
+// including their permissions, and custom permissions.
+func loadProtoUser(ctx context.Context, da dao.DataAccessor, userAccountId string) (*pb.User, error) {
+	roleBindings, err := da.GetUserRoleBindings(ctx, userAccountId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get user roles bindings: %v", err)
 	}
-	protoRoles := UserRoleBindingsToProtoRoles(serv.Dao, roleBindings)
+	protoRoles, err := UserRoleBindingsToProtoRoles(ctx, da, roleBindings)
+	if err != nil {
+		return nil, err
+	}
 	for _, role := range protoRoles {
-		permBindings, err := serv.Dao.GetRolePermissions(role.Id)
+		// skipping the role would drop its negated permissions
+		permBindings, err := da.GetRolePermissions(ctx, role.Id)
 		if err != nil {
-			continue
+			return nil, status.Errorf(codes.Internal, "could not get role permissions: %v", err)
 		}
 		rolePerms := make([]string, len(permBindings))
 		for i, binding := range permBindings {
@@ -27,7 +45,7 @@ func (serv IndigoServiceServer) GetUser(_ context.Context, req *pb.GetUserReques
 		role.Permissions = rolePerms
 	}
 
-	permBindings, err := serv.Dao.GetUserPermissions(req.UserAccountId)
+	permBindings, err := da.GetUserPermissions(ctx, userAccountId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not get user permission bindings: %v", err)
 	}
@@ -36,53 +54,19 @@ func (serv IndigoServiceServer) GetUser(_ context.Context, req *pb.GetUserReques
 		perms[i] = binding.Permission
 	}
 
-	return &pb.GetUserResponse{
-		User: &pb.User{
-			AccountId:         req.UserAccountId,
-			Roles:             protoRoles,
-			CustomPermissions: perms,
-		},
+	return &pb.User{
+		AccountId:         userAccountId,
+		Roles:             protoRoles,
+		CustomPermissions: perms,
 	}, nil
 }
 
-func (serv IndigoServiceServer) HasPermission(_ context.Context, req *pb.HasPermissionRequest) (*pb.HasPermissionResponse, error) {
-	roleBindings, err := serv.Dao.GetUserRoleBindings(req.UserAccountId)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not get user roles bindings: %v", err)
-	}
-
-	permBindings, err := serv.Dao.GetUserPermissions(req.UserAccountId)
+func (serv IndigoServiceServer) HasPermission(ctx context.Context, req *pb.HasPermissionRequest) (*pb.HasPermissionResponse, error) {
+	user, err := loadProtoUser(ctx, serv.Dao, req.UserAccountId)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "could not get user permission bindings: %v", err)
+		return nil, err
 	}
-
-	var prevPrio int32
-	v := perm.NewValidator([]string{})
-	for _, binding := range roleBindings {
-		r, err := serv.Dao.GetRole(model.ToRoleUuidIdentifier(binding.RoleId))
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "could not get role: %v", err)
-		}
-
-		b, err := serv.Dao.GetRolePermissions(binding.RoleId)
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "could not get role permissions: %v", err)
-		}
-
-		var rolePerms []string
-		for _, permissionBinding := range b {
-			rolePerms = append(rolePerms, permissionBinding.Permission)
-		}
-
-		v.Append(rolePerms, prevPrio < r.Priority)
-		prevPrio = r.Priority
-	}
-
-	var perms []string
-	for _, binding := range permBindings {
-		perms = append(perms, binding.Permission)
-	}
-	validator := perm.NewValidator(perms)
+	validator := perm.NewUserValidator(user)
 
 	res := false
 	for _, permission := range req.Permissions {
@@ -92,6 +76,11 @@ func (serv IndigoServiceServer) HasPermission(_ context.Context, req *pb.HasPerm
 		}
 		res = true
 	}
+	if res {
+		metrics.PermissionChecks.WithLabelValues("allow").Inc()
+	} else {
+		metrics.PermissionChecks.WithLabelValues("deny").Inc()
+	}
 
 	return &pb.HasPermissionResponse{
 		Result: res,
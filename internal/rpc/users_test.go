@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"github.com/cownetwork/indigo/internal/model"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+const moderatorRoleId = "e2a4c6d8-1b3f-4a5c-8e7d-9f0a1b2c3d4e"
+
+// failingDao fails to read the permissions of one role.
+type failingDao struct {
+	*memoryDao
+	roleId string
+}
+
+func (d *failingDao) GetRolePermissions(ctx context.Context, roleId string) ([]*model.RolePermissionBinding, error) {
+	if roleId == d.roleId {
+		return nil, errors.New("connection reset")
+	}
+	return d.memoryDao.GetRolePermissions(ctx, roleId)
+}
+
+func newPriorityDao(custom ...string) *memoryDao {
+	d := newMemoryDao()
+	d.roles[roleId] = &model.Role{Id: roleId, Name: "default", Type: "test", Priority: 1, Permissions: []string{"cow.chat", "cow.fly"}}
+	d.roles[moderatorRoleId] = &model.Role{Id: moderatorRoleId, Name: "muted", Type: "test", Priority: 2, Permissions: []string{"-cow.chat"}}
+	d.userRoles[accountId] = []string{roleId, moderatorRoleId}
+	d.userPermissions[accountId] = custom
+	return d
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name   string
+		custom []string
+		perm   string
+		result bool
+	}{
+		{"granted by lower role", nil, "cow.fly", true},
+		{"negated by higher role", nil, "cow.chat", false},
+		{"granted by custom permission", []string{"cow.chat"}, "cow.chat", true},
+		{"not granted", nil, "moo.fly", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serv := IndigoServiceServer{Dao: newPriorityDao(test.custom...)}
+			res, err := serv.HasPermission(context.Background(), &pb.HasPermissionRequest{
+				UserAccountId: accountId,
+				Permissions:   []string{test.perm},
+			})
+			if err != nil {
+				t.Fatalf("HasPermission failed: %v", err)
+			}
+			if res.Result != test.result {
+				t.Errorf("HasPermission returned %v, want %v", res.Result, test.result)
+			}
+		})
+	}
+}
+
+func TestHasPermissionFailsClosed(t *testing.T) {
+	serv := IndigoServiceServer{Dao: &failingDao{memoryDao: newPriorityDao(), roleId: moderatorRoleId}}
+	res, err := serv.HasPermission(context.Background(), &pb.HasPermissionRequest{
+		UserAccountId: accountId,
+		Permissions:   []string{"cow.chat"},
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("HasPermission returned %v and %v, want %v", res, err, codes.Internal)
+	}
+}
@@ -0,0 +1,175 @@
+package rpc
+
+import (
+	"encoding/json"
+	"github.com/cownetwork/indigo/internal/dao"
+	"github.com/cownetwork/indigo/internal/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"time"
+)
+
+const (
+	watchServiceName = "cow.indigo.v1.IndigoWatchService"
+	watchBatchSize   = 100
+)
+
+type WatchRequest struct {
+	// RoleIds and AccountIds restrict the stream to the events of
+	// these roles and users. All events are streamed if both are empty.
+	RoleIds    []string `json:"role_ids"`
+	AccountIds []string `json:"account_ids"`
+	// EventTypes restricts the stream to events of these CloudEvent types.
+	EventTypes []string `json:"event_types"`
+	// ResumeToken is the token of the last event received before. The
+	// stream starts with the next change that happens if it is empty.
+	ResumeToken string `json:"resume_token"`
+}
+
+type WatchResponse struct {
+	// ResumeToken continues the stream after this event when reconnecting.
+	ResumeToken string `json:"resume_token"`
+	// Event is the CloudEvent in its JSON format. It is missing if the
+	// stream only moved past events which do not match its filter, so
+	// that the client can resume after them.
+	Event json.RawMessage `json:"event,omitempty"`
+}
+
+// WatchService streams the events of indigo to clients which
+// cannot consume them from the sink, served with the JSON codec.
+type WatchService interface {
+	Watch(*WatchRequest, WatchService_WatchServer) error
+}
+
+type WatchService_WatchServer interface {
+	Send(*WatchResponse) error
+	grpc.ServerStream
+}
+
+type watchServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (s *watchServiceWatchServer) Send(m *WatchResponse) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+// WatchServiceServer polls the events which have been relayed from
+// the outbox every PollInterval, so it sees them in the order they
+// have been published, across all instances.
+type WatchServiceServer struct {
+	Dao          dao.DataAccessor
+	PollInterval time.Duration
+	// Done is closed when the server shuts down, which ends all
+	// streams, so that the clients resume them on another instance.
+	Done <-chan struct{}
+}
+
+var WatchService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: watchServiceName,
+	HandlerType: (*WatchService)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Watch",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				in := new(WatchRequest)
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(WatchService).Watch(in, &watchServiceWatchServer{stream})
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "indigo/watch",
+}
+
+func (serv WatchServiceServer) Watch(req *WatchRequest, stream WatchService_WatchServer) error {
+	ctx := stream.Context()
+
+	var position int64
+	if len(req.ResumeToken) > 0 {
+		p, err := strconv.ParseInt(req.ResumeToken, 10, 64)
+		if err != nil || p < 0 {
+			return status.Error(codes.InvalidArgument, "invalid resume token")
+		}
+		position = p
+	} else {
+		p, err := serv.Dao.GetLatestOutboxPosition(ctx)
+		if err != nil {
+			return status.Errorf(codes.Internal, "could not get latest event: %v", err)
+		}
+		position = p
+	}
+
+	filter := model.OutboxFilter{
+		Subjects: append(append([]string(nil), req.RoleIds...), req.AccountIds...),
+		Types:    req.EventTypes,
+	}
+
+	ticker := time.NewTicker(serv.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// the latest position is read before the events, so that the
+		// stream can move past the events which do not match its filter
+		latest, err := serv.Dao.GetLatestOutboxPosition(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return status.Errorf(codes.Internal, "could not get latest event: %v", err)
+		}
+		events, err := serv.Dao.GetOutboxEventsAfter(ctx, position, filter, watchBatchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return status.Errorf(codes.Internal, "could not get events: %v", err)
+		}
+
+		// the horizon is checked after the events have been read,
+		// as they might have been deleted after it has been checked
+		horizon, err := serv.Dao.GetOutboxHorizon(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return status.Errorf(codes.Internal, "could not get outbox horizon: %v", err)
+		}
+		if position < horizon {
+			return status.Error(codes.OutOfRange, "resume token expired, the events after it have been deleted")
+		}
+
+		for _, e := range events {
+			position = *e.Position
+			err := stream.Send(&WatchResponse{
+				ResumeToken: strconv.FormatInt(position, 10),
+				Event:       e.Payload,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(events) == watchBatchSize {
+			continue
+		}
+		if latest > position {
+			position = latest
+			if err := stream.Send(&WatchResponse{ResumeToken: strconv.FormatInt(position, 10)}); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-serv.Done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-ticker.C:
+		}
+	}
+}
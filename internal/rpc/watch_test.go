@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+// recordingStream records the responses sent on it.
+type recordingStream struct {
+	grpc.ServerStream
+	responses []*WatchResponse
+}
+
+func (s *recordingStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *recordingStream) Send(res *WatchResponse) error {
+	s.responses = append(s.responses, res)
+	return nil
+}
+
+// newWatchDao returns an outbox with an event about the account at
+// position 1, followed by events about another account and a dead event.
+func newWatchDao() *memoryDao {
+	d := newMemoryDao()
+	now := time.Now()
+	for i, subject := range []string{accountId, targetAccountId, targetAccountId, accountId} {
+		position := int64(i + 1)
+		d.outbox = append(d.outbox, &model.OutboxEvent{
+			Id:       position,
+			Subject:  subject,
+			Payload:  []byte(`{}`),
+			Position: &position,
+		})
+	}
+	d.outbox[3].DeadAt = &now
+	return d
+}
+
+// watch runs a single poll of the stream, as the server shuts down.
+func watch(t *testing.T, d *memoryDao, token string) ([]*WatchResponse, error) {
+	t.Helper()
+	done := make(chan struct{})
+	close(done)
+	serv := WatchServiceServer{Dao: d, PollInterval: time.Hour, Done: done}
+
+	stream := &recordingStream{}
+	err := serv.Watch(&WatchRequest{AccountIds: []string{accountId}, ResumeToken: token}, stream)
+	if status.Code(err) == codes.Unavailable {
+		err = nil
+	}
+	return stream.responses, err
+}
+
+func TestWatchMovesPastFilteredEvents(t *testing.T) {
+	d := newWatchDao()
+	res, err := watch(t, d, "0")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if len(res) != 2 || len(res[0].Event) == 0 || res[0].ResumeToken != "1" {
+		t.Fatalf("Watch sent %v, want the event at 1 and a resume token", res)
+	}
+	if len(res[1].Event) > 0 || res[1].ResumeToken != "4" {
+		t.Fatalf("Watch sent %v after the event, want the resume token 4 without event", res[1])
+	}
+
+	// the events of the other account have been cleaned up
+	d.outbox = d.outbox[3:]
+	d.horizon = 3
+	res, err = watch(t, d, res[1].ResumeToken)
+	if err != nil {
+		t.Fatalf("Watch failed after the cleanup: %v", err)
+	}
+	if len(res) > 0 {
+		t.Errorf("Watch sent %v, want nothing", res)
+	}
+
+	if _, err := watch(t, d, "1"); status.Code(err) != codes.OutOfRange {
+		t.Errorf("Watch of an expired token returned %v, want %v", err, codes.OutOfRange)
+	}
+}
@@ -0,0 +1,139 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/cownetwork/indigo/internal/eventhandler"
+	"github.com/cownetwork/indigo/internal/model"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"time"
+)
+
+type Webhook struct {
+	Id            string     `json:"id"`
+	Url           string     `json:"url"`
+	EventTypes    []string   `json:"event_types"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	Failures      int        `json:"failures"`
+}
+
+type RegisterWebhookRequest struct {
+	Url string `json:"url"`
+	// EventTypes the webhook receives. It receives all events if empty.
+	EventTypes []string `json:"event_types"`
+	// Secret the requests are signed with. One is generated if empty.
+	Secret string `json:"secret"`
+}
+
+type RegisterWebhookResponse struct {
+	Webhook *Webhook `json:"webhook"`
+	Secret  string   `json:"secret"`
+}
+
+type ListWebhooksRequest struct{}
+
+type ListWebhooksResponse struct {
+	Webhooks []*Webhook `json:"webhooks"`
+}
+
+type DeleteWebhookRequest struct {
+	Id string `json:"id"`
+}
+
+type DeleteWebhookResponse struct{}
+
+func (serv AdminServiceServer) RegisterWebhook(ctx context.Context, req *RegisterWebhookRequest) (*RegisterWebhookResponse, error) {
+	u, err := url.Parse(req.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "url has to be an absolute http or https url")
+	}
+	for _, etype := range req.EventTypes {
+		if etype != eventhandler.RoleUpdateEventType && etype != eventhandler.UserPermissionUpdateEventType {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown event type %q", etype)
+		}
+	}
+
+	secret := req.Secret
+	if len(secret) == 0 {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, status.Errorf(codes.Internal, "could not generate secret: %v", err)
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	// the webhook receives the events that happen from now on
+	position, err := serv.Dao.GetLatestOutboxPosition(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not get latest event: %v", err)
+	}
+
+	webhook := &model.Webhook{
+		Id:         uuid.New().String(),
+		Url:        req.Url,
+		EventTypes: append([]string{}, req.EventTypes...),
+		Secret:     secret,
+		Position:   position,
+	}
+	if err := serv.Dao.InsertWebhook(ctx, webhook); err != nil {
+		return nil, status.Errorf(codes.Internal, "could not insert webhook: %v", err)
+	}
+
+	return &RegisterWebhookResponse{
+		Webhook: toWebhook(webhook),
+		Secret:  secret,
+	}, nil
+}
+
+func (serv AdminServiceServer) ListWebhooks(ctx context.Context, req *ListWebhooksRequest) (*ListWebhooksResponse, error) {
+	webhooks, err := serv.Dao.ListWebhooks(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not list webhooks: %v", err)
+	}
+
+	res := make([]*Webhook, len(webhooks))
+	for i, w := range webhooks {
+		res[i] = toWebhook(w)
+	}
+
+	return &ListWebhooksResponse{
+		Webhooks: res,
+	}, nil
+}
+
+func (serv AdminServiceServer) DeleteWebhook(ctx context.Context, req *DeleteWebhookRequest) (*DeleteWebhookResponse, error) {
+	if _, err := uuid.Parse(req.Id); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id has to be a uuid")
+	}
+
+	ok, err := serv.Dao.DeleteWebhook(ctx, req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not delete webhook: %v", err)
+	}
+	if !ok {
+		return nil, status.Error(codes.NotFound, "webhook not found")
+	}
+
+	return &DeleteWebhookResponse{}, nil
+}
+
+// toWebhook converts w without its secret, which is only returned on registration.
+func toWebhook(w *model.Webhook) *Webhook {
+	return &Webhook{
+		Id:            w.Id,
+		Url:           w.Url,
+		EventTypes:    w.EventTypes,
+		CreatedAt:     w.CreatedAt,
+		LastAttemptAt: w.LastAttemptAt,
+		LastSuccessAt: w.LastSuccessAt,
+		LastError:     w.LastError,
+		Failures:      w.Failures,
+	}
+}
@@ -0,0 +1,164 @@
+// Package client is a Go client for indigo, which caches users and roles
+// locally and keeps them in sync by consuming the events indigo sends.
+package client
+
+import (
+	"context"
+	"github.com/cownetwork/indigo/internal/perm"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	KafkaBrokers []string
+	KafkaTopic   string
+	// ConsumerGroup is the Kafka consumer group of the client. Every
+	// instance has to receive all events to keep its own cache up to
+	// date, so instances must never share a group, as Kafka would split
+	// the partitions between them. It defaults to a unique group.
+	ConsumerGroup string
+	// CacheTTL is the time after which a cached user is fetched again,
+	// in case an event got lost. Zero lets users never expire.
+	CacheTTL time.Duration
+}
+
+type Client struct {
+	pb.IndigoServiceClient
+	opts Options
+
+	mu    sync.RWMutex
+	users map[string]*cachedUser
+	roles map[string]*pb.Role
+	// roleSeqs contains the sequence of the last event applied for a role.
+	roleSeqs map[string]string
+	// epoch is increased with every received event, so that
+	// users fetched while an event arrived are not cached.
+	epoch uint64
+}
+
+type cachedUser struct {
+	roleIds           []string
+	customPermissions []string
+	expires           time.Time
+}
+
+func New(conn grpc.ClientConnInterface, opts Options) *Client {
+	if len(opts.KafkaTopic) == 0 {
+		opts.KafkaTopic = "cow.global.indigo"
+	}
+	if len(opts.ConsumerGroup) == 0 {
+		opts.ConsumerGroup = "indigo-client-" + uuid.New().String()
+	}
+	return &Client{
+		IndigoServiceClient: pb.NewIndigoServiceClient(conn),
+		opts:                opts,
+		users:               map[string]*cachedUser{},
+		roles:               map[string]*pb.Role{},
+		roleSeqs:            map[string]string{},
+	}
+}
+
+// HasPermission checks locally whether the user has all given permissions.
+// The user and its roles are fetched from indigo if they are not cached.
+func (c *Client) HasPermission(ctx context.Context, accountId string, permissions ...string) (bool, error) {
+	user, err := c.User(ctx, accountId)
+	if err != nil {
+		return false, err
+	}
+
+	v := NewValidator(user)
+	res := false
+	for _, permission := range permissions {
+		if !v.Validate(permission) {
+			return false, nil
+		}
+		res = true
+	}
+	return res, nil
+}
+
+// User returns the user with its roles and their permissions, from the cache if possible.
+func (c *Client) User(ctx context.Context, accountId string) (*pb.User, error) {
+	c.mu.RLock()
+	u, ok := c.users[accountId]
+	epoch := c.epoch
+	var user *pb.User
+	if ok && (c.opts.CacheTTL == 0 || time.Now().Before(u.expires)) {
+		user = c.buildUser(accountId, u)
+	}
+	c.mu.RUnlock()
+	if user != nil {
+		return user, nil
+	}
+
+	res, err := c.GetUser(ctx, &pb.GetUserRequest{UserAccountId: accountId})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch == c.epoch {
+		c.cacheUser(res.User)
+	}
+	return res.User, nil
+}
+
+// Invalidate removes the user from the cache.
+func (c *Client) Invalidate(accountId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.users, accountId)
+	c.epoch++
+}
+
+// buildUser has to be called with c.mu held. It returns
+// nil if one of the roles of the user is not cached.
+func (c *Client) buildUser(accountId string, u *cachedUser) *pb.User {
+	user := &pb.User{
+		AccountId:         accountId,
+		CustomPermissions: u.customPermissions,
+	}
+	for _, id := range u.roleIds {
+		role, ok := c.roles[id]
+		if !ok {
+			return nil
+		}
+		user.Roles = append(user.Roles, role)
+	}
+	return user
+}
+
+// cacheUser has to be called with c.mu held.
+func (c *Client) cacheUser(user *pb.User) {
+	u := &cachedUser{
+		customPermissions: user.CustomPermissions,
+		expires:           time.Now().Add(c.opts.CacheTTL),
+	}
+	for _, role := range user.Roles {
+		u.roleIds = append(u.roleIds, role.Id)
+		c.roles[role.Id] = role
+	}
+	c.users[user.AccountId] = u
+}
+
+// Validator checks the permissions of a user.
+type Validator struct {
+	v *perm.Validator
+}
+
+// NewValidator creates a validator for the permissions of user, which
+// evaluates them just like the HasPermission method of indigo. The
+// permissions of roles with a higher priority override the ones of
+// lower roles, the custom permissions of the user override all roles.
+func NewValidator(user *pb.User) *Validator {
+	return &Validator{v: perm.NewUserValidator(user)}
+}
+
+// Validate returns whether the user has the permission.
+func (v *Validator) Validate(permission string) bool {
+	return v.v.Validate(permission)
+}
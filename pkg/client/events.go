@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/cloudevents/sdk-go/protocol/kafka_sarama/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+	pb "github.com/cownetwork/mooapis-go/cow/indigo/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"log"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// Run consumes the events of indigo from Kafka and updates
+// the cache accordingly, until ctx is done.
+func (c *Client) Run(ctx context.Context) error {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Version = sarama.V2_0_0_0
+
+	consumer, err := kafka_sarama.NewConsumer(c.opts.KafkaBrokers, saramaConfig, c.opts.ConsumerGroup, c.opts.KafkaTopic)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close(context.Background())
+
+	ce, err := cloudevents.NewClient(consumer)
+	if err != nil {
+		return err
+	}
+
+	// the cache may have missed events while not consuming
+	c.clear()
+
+	return ce.StartReceiver(ctx, func(event cloudevents.Event) {
+		if err := c.handleEvent(event); err != nil {
+			log.Printf("Could not handle indigo event %s: %v", event.ID(), err)
+		}
+	})
+}
+
+func (c *Client) handleEvent(event cloudevents.Event) error {
+	switch event.Type() {
+	case "cow.indigo.v1.RoleUpdateEvent":
+		var e pb.RoleUpdateEvent
+		if err := decodeData(event, &e); err != nil {
+			return err
+		}
+		seq, _ := types.ToString(event.Extensions()["sequence"])
+		c.updateRole(e.Role, e.Action, seq)
+	case "cow.indigo.v1.UserPermissionUpdateEvent":
+		var e pb.UserPermissionUpdateEvent
+		if err := decodeData(event, &e); err != nil {
+			return err
+		}
+		c.Invalidate(e.User.GetAccountId())
+	}
+	return nil
+}
+
+// updateRole applies a role event, unless a later event
+// of the role, according to its sequence, has been applied.
+func (c *Client) updateRole(role *pb.Role, action pb.RoleUpdateEvent_Action, seq string) {
+	if role == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(seq) > 0 {
+		if seq <= c.roleSeqs[role.Id] {
+			return
+		}
+		c.roleSeqs[role.Id] = seq
+	}
+	if action == pb.RoleUpdateEvent_ACTION_DELETED {
+		delete(c.roles, role.Id)
+	} else {
+		c.roles[role.Id] = role
+	}
+	c.epoch++
+}
+
+func (c *Client) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users = map[string]*cachedUser{}
+	c.roles = map[string]*pb.Role{}
+	c.roleSeqs = map[string]string{}
+	c.epoch++
+}
+
+// decodeData decodes the data of event, which is encoded either
+// as binary protobuf or as JSON, depending on the indigo configuration.
+func decodeData(event cloudevents.Event, m proto.Message) error {
+	switch event.DataContentType() {
+	case "application/protobuf":
+		return proto.Unmarshal(event.Data(), m)
+	case cloudevents.ApplicationJSON:
+		return protojson.Unmarshal(event.Data(), m)
+	}
+	return fmt.Errorf("unsupported data content type %q", event.DataContentType())
+}